@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"net/http"
+	"path/filepath"
+	"time"
+)
+
+const (
+	AccessLogFormatCombined = "combined"
+	AccessLogFormatJson     = "json"
+
+	accessLogTimeLayout = "02/Jan/2006:15:04:05 -0700"
+)
+
+type AccessLogger struct {
+	writer     io.Writer
+	format     string
+	hashUserId bool
+}
+
+type AccessLogEntry struct {
+	Time      string `json:"time"`
+	RequestId string `json:"requestId,omitempty"`
+	ClientIP  string `json:"clientIp"`
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	Query     string `json:"query"`
+	Proto     string `json:"proto"`
+	Scheme    string `json:"scheme"`
+	Status    int    `json:"status"`
+	Bytes     int64  `json:"bytes"`
+	LatencyUs int64  `json:"latencyUs"`
+	Referer   string `json:"referer"`
+	UserAgent string `json:"userAgent"`
+}
+
+var gobalAccessLogger *AccessLogger
+
+func initAccessLog() {
+	if gobalConfig.AccessLog == "" {
+		return
+	}
+
+	fileName := gobalConfig.AccessLog
+	if !filepath.IsAbs(fileName) {
+		fileName = filepath.Join(gobalConfig.LogPath, fileName)
+	}
+
+	gobalAccessLogger = &AccessLogger{
+		writer:     newRotateWriter(fileName),
+		format:     gobalConfig.AccessLogFormat,
+		hashUserId: gobalConfig.AccessLogHashUserId,
+	}
+}
+
+// responseRecorder remembers the status code and body size written to the client.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (p *responseRecorder) WriteHeader(code int) {
+	if p.status == 0 {
+		p.status = code
+	}
+	p.ResponseWriter.WriteHeader(code)
+}
+
+func (p *responseRecorder) Write(b []byte) (int, error) {
+	if p.status == 0 {
+		p.status = http.StatusOK
+	}
+	n, err := p.ResponseWriter.Write(b)
+	p.bytes += int64(n)
+	return n, err
+}
+
+func (p *responseRecorder) Status() int {
+	if p.status == 0 {
+		return http.StatusOK
+	}
+	return p.status
+}
+
+func accessLogging(logger *AccessLogger) Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		if logger == nil {
+			return fn
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			recorder := &responseRecorder{ResponseWriter: w}
+			start := time.Now()
+
+			defer func() {
+				logger.Write(r, recorder, time.Since(start))
+			}()
+
+			fn(recorder, r)
+		}
+	}
+}
+
+func (p *AccessLogger) Write(r *http.Request, recorder *responseRecorder, latency time.Duration) {
+	entry := AccessLogEntry{
+		Time:      time.Now().Format(accessLogTimeLayout),
+		RequestId: recorder.Header().Get(RequestIdHeader),
+		ClientIP:  clientIP(r),
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		Query:     p.query(r),
+		Proto:     r.Proto,
+		Scheme:    requestScheme(r),
+		Status:    recorder.Status(),
+		Bytes:     recorder.bytes,
+		LatencyUs: latency.Nanoseconds() / int64(time.Microsecond),
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+	}
+
+	var line []byte
+	if p.format == AccessLogFormatJson {
+		b, err := json.Marshal(entry)
+		if err != nil {
+			log.Errorf("[AccessLogger.Write] json.Marshal failed. error=%v", err)
+			return
+		}
+		line = append(b, '\n')
+	} else {
+		line = []byte(p.combined(entry))
+	}
+
+	if _, err := p.writer.Write(line); err != nil {
+		log.Errorf("[AccessLogger.Write] write access log failed. error=%v", err)
+	}
+}
+
+// combined renders the Apache combined log format, followed by the request id and the
+// latency in microseconds.
+func (p *AccessLogger) combined(e AccessLogEntry) string {
+	uri := e.Path
+	if e.Query != "" {
+		uri += "?" + e.Query
+	}
+
+	requestId := e.RequestId
+	if requestId == "" {
+		requestId = "-"
+	}
+
+	return fmt.Sprintf("%s - - [%s] %q %d %d %q %q %s %d\n",
+		e.ClientIP, e.Time, e.Method+" "+uri+" "+e.Proto, e.Status, e.Bytes, e.Referer, e.UserAgent, requestId, e.LatencyUs)
+}
+
+func (p *AccessLogger) query(r *http.Request) string {
+	if !p.hashUserId {
+		return r.URL.RawQuery
+	}
+
+	values := r.URL.Query()
+	if userIds, ok := values["userId"]; ok {
+		for i, userId := range userIds {
+			userIds[i] = hashUserId(userId)
+		}
+	}
+
+	return values.Encode()
+}
+
+func hashUserId(userId string) string {
+	sum := sha256.Sum256([]byte(userId))
+	return hex.EncodeToString(sum[:8])
+}
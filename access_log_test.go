@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Suite(&AccessLogSuite{})
+
+type AccessLogSuite struct{}
+
+// serve runs a request through accessLogging with logger, answering 201 and a body of 5
+// bytes.
+func (p *AccessLogSuite) serve(logger *AccessLogger, url string) {
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(RequestIdHeader, "req-1")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}, accessLogging(logger))
+
+	r := httptest.NewRequest("GET", url, nil)
+	r.Header.Set("User-Agent", "test-agent")
+	r.Header.Set("Referer", "https://example.com/")
+	handler(httptest.NewRecorder(), r)
+}
+
+func (p *AccessLogSuite) Test_combined(c *C) {
+	var b bytes.Buffer
+	p.serve(&AccessLogger{writer: &b, format: AccessLogFormatCombined}, "/getfollowers/info?userId=000000001")
+
+	c.Assert(b.String(), Matches, `192\.0\.2\.1 - - \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] `+
+		`"GET /getfollowers/info\?userId=000000001 HTTP/1\.1" 201 5 "https://example\.com/" "test-agent" req-1 \d+\n`)
+}
+
+func (p *AccessLogSuite) Test_json_hashUserId(c *C) {
+	var b bytes.Buffer
+	p.serve(&AccessLogger{writer: &b, format: AccessLogFormatJson, hashUserId: true}, "/getfollowers/info?userId=000000001&version=1")
+
+	var entry AccessLogEntry
+	c.Assert(json.Unmarshal(b.Bytes(), &entry), IsNil)
+	c.Assert(entry.RequestId, Equals, "req-1")
+	c.Assert(entry.ClientIP, Equals, "192.0.2.1")
+	c.Assert(entry.Method, Equals, "GET")
+	c.Assert(entry.Path, Equals, "/getfollowers/info")
+	c.Assert(entry.Query, Equals, "userId="+hashUserId("000000001")+"&version=1")
+	c.Assert(entry.Scheme, Equals, "http")
+	c.Assert(entry.Status, Equals, http.StatusCreated)
+	c.Assert(entry.Bytes, Equals, int64(5))
+	c.Assert(entry.UserAgent, Equals, "test-agent")
+}
+
+func (p *AccessLogSuite) Test_hashUserId(c *C) {
+	c.Assert(hashUserId("000000001"), HasLen, 16)
+	c.Assert(hashUserId("000000001"), Equals, hashUserId("000000001"))
+	c.Assert(hashUserId("000000001"), Not(Equals), hashUserId("000000002"))
+}
+
+func (p *AccessLogSuite) Test_responseRecorder_status(c *C) {
+	recorder := &responseRecorder{ResponseWriter: httptest.NewRecorder()}
+	c.Assert(recorder.Status(), Equals, http.StatusOK)
+
+	recorder.WriteHeader(http.StatusNotFound)
+	recorder.WriteHeader(http.StatusInternalServerError)
+	c.Assert(recorder.Status(), Equals, http.StatusNotFound)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"strings"
+)
+
+const UnixAddrPrefix = "unix:"
+
+var gobalAdminServer *http.Server
+
+// startAdmin serves the internal endpoints on admin_addr, apart from the client api. With
+// client_ca_file it serves https and every route except the health checks requires a
+// verified client certificate.
+func startAdmin() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", healthzHandler)
+	mux.HandleFunc("/readyz", readyzHandler)
+	mux.HandleFunc("/counter", Decorate(handle(counterHander), adminDecorators()...))
+	mux.HandleFunc("/metrics", Decorate(metricsHandler, adminDecorators()...))
+	mux.HandleFunc("/admin/reload", Decorate(handle(reloadHandler), adminDecorators()...))
+	mux.HandleFunc("/admin/maintenance", Decorate(maintenanceHandler, adminDecorators()...))
+	mux.HandleFunc("/admin/openapi.json", Decorate(openApiHandler, adminDecorators()...))
+
+	mux.HandleFunc("/debug/pprof/", Decorate(pprof.Index, adminDecorators()...))
+	mux.HandleFunc("/debug/pprof/cmdline", Decorate(pprof.Cmdline, adminDecorators()...))
+	mux.HandleFunc("/debug/pprof/profile", Decorate(pprof.Profile, adminDecorators()...))
+	mux.HandleFunc("/debug/pprof/symbol", Decorate(pprof.Symbol, adminDecorators()...))
+	mux.HandleFunc("/debug/pprof/trace", Decorate(pprof.Trace, adminDecorators()...))
+
+	listener, err := listenAdmin(gobalConfig.AdminAddr)
+	if err != nil {
+		log.Errorf("[startAdmin] listen failed. addr=%v error=%v", gobalConfig.AdminAddr, err)
+		os.Exit(1)
+	}
+
+	// no write timeout, /debug/pprof/profile and trace stream for as long as asked.
+	gobalAdminServer = &http.Server{Handler: mux, ReadHeaderTimeout: gobalConfig.ReadHeaderTimeout, IdleTimeout: gobalConfig.IdleTimeout}
+	if gobalConfig.ClientCAFile != "" {
+		gobalAdminServer.TLSConfig = newTLSConfig(true)
+		listener = tls.NewListener(listener, gobalAdminServer.TLSConfig)
+	}
+
+	log.Infof("start admin server. addr=%v tls=%v", gobalConfig.AdminAddr, gobalConfig.ClientCAFile != "")
+
+	go func() {
+		err := gobalAdminServer.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("[startAdmin] admin server failed. error=%v", err)
+			os.Exit(1)
+		}
+	}()
+}
+
+// adminDecorators returns the decorators shared by the admin routes, innermost first.
+func adminDecorators() []Decorator {
+	return []Decorator{
+		requireClientCert(),
+	}
+}
+
+func listenAdmin(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, UnixAddrPrefix) {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, UnixAddrPrefix)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.Chmod(path, 0660); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// reloadHandler reloads the config like SIGHUP, answering ERROR_INTERNAL with the reason if
+// the config is invalid.
+func reloadHandler(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil
+	}
+
+	if err := reloadConfig(); err != nil {
+		return NewErrorMsg(ERROR_INTERNAL, err.Error(), "[reloadHandler] reload config failed. error=%v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]interface{}{"reloaded": true})
+}
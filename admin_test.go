@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ = Suite(&AdminSuite{})
+
+type AdminSuite struct{}
+
+// SetUpSuite defines the flags reloadConfig reads its defaults from.
+func (p *AdminSuite) SetUpSuite(c *C) {
+	if flag.CommandLine.Lookup("config") == nil {
+		defineFlags(flag.CommandLine)
+	}
+}
+
+func (p *AdminSuite) Test_reloadHandler_method(c *C) {
+	for _, method := range []string{"GET", "PUT"} {
+		w := httptest.NewRecorder()
+		c.Assert(reloadHandler(w, httptest.NewRequest(method, "/admin/reload", nil)), IsNil)
+
+		c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+		c.Assert(w.Header().Get("Allow"), Equals, http.MethodPost)
+		c.Assert(w.Body.Len(), Equals, 0)
+	}
+}
+
+func (p *AdminSuite) Test_reloadHandler(c *C) {
+	defer func(file string) { gobalConfigFile = file }(gobalConfigFile)
+	defer func(cfg Config) { gobalConfig = cfg }(currentConfig())
+	dir := c.MkDir()
+	for _, name := range []string{"server.crt", "server.key"} {
+		c.Assert(ioutil.WriteFile(filepath.Join(dir, name), nil, 0600), IsNil)
+	}
+	gobalConfigFile = filepath.Join(dir, "follower.yaml")
+	content := fmt.Sprintf("mongo_uri: mongodb://localhost\npush_batch_size: 7\ncert_file: %v/server.crt\nkey_file: %v/server.key\n", dir, dir)
+	c.Assert(ioutil.WriteFile(gobalConfigFile, []byte(content), 0600), IsNil)
+
+	w := httptest.NewRecorder()
+	c.Assert(reloadHandler(w, httptest.NewRequest("POST", "/admin/reload", nil)), IsNil)
+
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Equals, "application/json")
+	c.Assert(w.Body.String(), Equals, "{\"reloaded\":true}\n")
+	c.Assert(currentConfig().PushBatchSize, Equals, 7)
+}
+
+func (p *AdminSuite) Test_reloadHandler_invalidConfig(c *C) {
+	defer func(file string) { gobalConfigFile = file }(gobalConfigFile)
+	gobalConfigFile = filepath.Join(c.MkDir(), "follower.yaml")
+	c.Assert(ioutil.WriteFile(gobalConfigFile, []byte("no_such_setting: 1\n"), 0600), IsNil)
+	before := currentConfig()
+
+	w := httptest.NewRecorder()
+	handle(reloadHandler)(w, httptest.NewRequest("POST", "/admin/reload", nil))
+
+	c.Assert(w.Code, Equals, http.StatusInternalServerError)
+	c.Assert(strings.Contains(w.Body.String(), "no_such_setting"), Equals, true, Commentf("body %v", w.Body.String()))
+	c.Assert(currentConfig(), DeepEquals, before)
+}
+
+func (p *AdminSuite) Test_metricsHandler(c *C) {
+	gobalApps = NewAppRegistry(Config{Apps: []AppConfig{{Name: "likes", DbName: "likes"}}})
+	w := httptest.NewRecorder()
+	metricsHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Equals, "text/plain; version=0.0.4")
+	body := w.Body.String()
+	for _, line := range []string{
+		"# TYPE follower_requests_total counter",
+		"# TYPE follower_pending_orders gauge",
+		`follower_pending_orders{app="default"} 0`,
+		`follower_pending_orders{app="likes"} 0`,
+		"follower_db_breaker_state 0",
+		"follower_grpc_watches 0",
+		"follower_maintenance 0",
+		"follower_draining 0",
+	} {
+		c.Assert(strings.Contains(body, line+"\n"), Equals, true, Commentf("line %q", line))
+	}
+}
+
+func (p *AdminSuite) Test_listenAdmin_unix(c *C) {
+	path := filepath.Join(c.MkDir(), "admin.sock")
+	c.Assert(ioutil.WriteFile(path, nil, 0600), IsNil)
+
+	// a socket file left by an earlier process is replaced.
+	listener, err := listenAdmin(UnixAddrPrefix + path)
+	c.Assert(err, IsNil)
+	defer listener.Close()
+
+	info, err := os.Stat(path)
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode()&os.ModeSocket, Not(Equals), os.FileMode(0))
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0660))
+}
+
+func (p *AdminSuite) Test_listenAdmin_tcp(c *C) {
+	listener, err := listenAdmin("127.0.0.1:0")
+	c.Assert(err, IsNil)
+	defer listener.Close()
+
+	c.Assert(listener.Addr().Network(), Equals, "tcp")
+}
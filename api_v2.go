@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+)
+
+// MaxJsonBodyBytes bounds the json body of the v2 routes.
+const MaxJsonBodyBytes = 64 << 10
+
+// The v2 requests. The api version is in the path, so they have no version parameter. They
+// are also the messages of the grpc service.
+type UserRequestV2 struct {
+	UserId string `param:"userId" validate:"required,userid" json:"userId"`
+}
+
+type CoinsRequestV2 struct {
+	UserId string `param:"userId" validate:"required,userid" json:"userId"`
+	Coins  int64  `param:"coins" validate:"required" json:"coins"`
+}
+
+type BuyFollowerRequestV2 struct {
+	UserId string `param:"userId" validate:"required,userid" json:"userId"`
+	Coins  int64  `param:"coins" validate:"required,min=1" json:"coins"`
+	Value  int64  `param:"value" validate:"required,min=1" json:"value"`
+}
+
+// jsonBody decodes the json body of a POST route into its request struct with decodeMessage,
+// answering ERROR_UNSUPPORTED_MEDIA_TYPE for another content type. The url parameters other
+// than app and lang are ignored. The decoded parameters replace r.Form, so that the userId
+// is rate limited and the Idempotency-Key fingerprint covers them, and the userId is added
+// to the request logger. The handler reads the request with bodyRequest.
+func jsonBody(route Route) Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		t := reflect.TypeOf(route.Request)
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			contentType := r.Header.Get("Content-Type")
+			if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || mediaType != "application/json" {
+				writeError(w, r, NewError(ERROR_UNSUPPORTED_MEDIA_TYPE, "[jsonBody] unsupported content type. contentType=%v", contentType))
+				return
+			}
+
+			data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxJsonBodyBytes))
+			if err != nil {
+				writeError(w, r, NewValidationError(t.Name(), []Violation{{"body", fmt.Sprintf("must be a json object of at most %v bytes", MaxJsonBodyBytes)}}))
+				return
+			}
+
+			req := reflect.New(t)
+			if err := decodeMessage(data, req.Interface()); err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			form := url.Values{}
+			for _, spec := range paramSpecs(t) {
+				form.Set(spec.Name, fmt.Sprint(req.Elem().Field(spec.field).Interface()))
+			}
+			query := r.URL.Query()
+			for _, name := range []string{AppParam, LangParam} {
+				if value := query.Get(name); value != "" {
+					form.Set(name, value)
+				}
+			}
+			r.Form, r.PostForm = form, form
+
+			ctx := context.WithValue(r.Context(), bodyContextKey, req.Interface())
+			if userId := form.Get("userId"); userId != "" {
+				ctx = context.WithValue(ctx, loggerContextKey, requestLogger(ctx).WithField("userId", userId))
+			}
+			fn(w, r.WithContext(ctx))
+		}
+	}
+}
+
+// bodyRequest copies the request decoded by jsonBody into req.
+func bodyRequest(r *http.Request, req interface{}) error {
+	decoded := r.Context().Value(bodyContextKey)
+	if decoded == nil {
+		return NewError(ERROR_INTERNAL, "[bodyRequest] no json body decoded. path=%v", r.URL.Path)
+	}
+
+	reflect.ValueOf(req).Elem().Set(reflect.ValueOf(decoded).Elem())
+	return nil
+}
+
+func progressHandlerV2(w http.ResponseWriter, r *http.Request) error {
+	var req UserRequestV2
+	if err := parseRequest(r, &req); err != nil {
+		return err
+	}
+
+	result, err := getProgress(r.Context(), appFromContext(r.Context()), req.UserId)
+	if err != nil {
+		return err
+	}
+
+	return responseToClient(w, result)
+}
+
+func infoHandlerV2(w http.ResponseWriter, r *http.Request) error {
+	var req UserRequestV2
+	if err := parseRequest(r, &req); err != nil {
+		return err
+	}
+
+	result, err := getInfo(r.Context(), appFromContext(r.Context()), req.UserId)
+	if err != nil {
+		return err
+	}
+
+	return responseToClient(w, result)
+}
+
+func getUserHandlerV2(w http.ResponseWriter, r *http.Request) error {
+	var req UserRequestV2
+	if err := bodyRequest(r, &req); err != nil {
+		return err
+	}
+
+	return getUsers(r.Context(), appFromContext(r.Context()), req.UserId, respondUsers(w))
+}
+
+func buyfollowerHandlerV2(w http.ResponseWriter, r *http.Request) error {
+	var req BuyFollowerRequestV2
+	if err := bodyRequest(r, &req); err != nil {
+		return err
+	}
+
+	result, err := buyFollowers(r.Context(), appFromContext(r.Context()), req.UserId, req.Coins, req.Value)
+	if err != nil {
+		return err
+	}
+
+	return responseToClient(w, result)
+}
+
+func coinsHandlerV2(w http.ResponseWriter, r *http.Request) error {
+	var req CoinsRequestV2
+	if err := bodyRequest(r, &req); err != nil {
+		return err
+	}
+
+	result, err := addCoins(r.Context(), appFromContext(r.Context()), req.UserId, req.Coins)
+	if err != nil {
+		return err
+	}
+
+	return responseToClient(w, result)
+}
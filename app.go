@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const (
+	DefaultAppName = "default"
+	AppParam       = "app"
+)
+
+// AppConfig describes one tenant app. Every app keeps its users in its own database and
+// has its own PushManager.
+type AppConfig struct {
+	Name     string   `yaml:"name"`
+	Hosts    []string `yaml:"hosts"`
+	DbName   string   `yaml:"db_name"`
+	CollName string   `yaml:"coll_name"`
+
+	// CoinsPerFollower is the minimum price of one follower in buyfollower. 0 accepts any price.
+	CoinsPerFollower int64 `yaml:"coins_per_follower"`
+}
+
+type App struct {
+	AppConfig
+	PushManager *PushManager
+}
+
+type AppRegistry struct {
+	defaultApp *App
+	byName     map[string]*App
+	byHost     map[string]*App
+}
+
+var gobalApps *AppRegistry
+
+// initApps creates the default app from the top level db_name, coll_name and
+// coins_per_follower, followed by the apps of the config file.
+func initApps() {
+	gobalApps = NewAppRegistry(gobalConfig)
+}
+
+func NewAppRegistry(cfg Config) *AppRegistry {
+	registry := &AppRegistry{
+		byName: make(map[string]*App),
+		byHost: make(map[string]*App),
+	}
+
+	defaultConfig := AppConfig{
+		Name:             DefaultAppName,
+		DbName:           cfg.DbName,
+		CollName:         cfg.CollName,
+		CoinsPerFollower: cfg.CoinsPerFollower,
+	}
+	registry.defaultApp = registry.add(defaultConfig)
+
+	for _, appConfig := range cfg.Apps {
+		if appConfig.CollName == "" {
+			appConfig.CollName = cfg.CollName
+		}
+		registry.add(appConfig)
+	}
+
+	return registry
+}
+
+func (p *AppRegistry) add(cfg AppConfig) *App {
+	app := &App{AppConfig: cfg, PushManager: NewPushManager(cfg.DbName, cfg.CollName)}
+
+	p.byName[cfg.Name] = app
+	for _, host := range cfg.Hosts {
+		p.byHost[strings.ToLower(host)] = app
+	}
+
+	return app
+}
+
+func (p *AppRegistry) All() []*App {
+	apps := make([]*App, 0, len(p.byName))
+	for _, app := range p.byName {
+		apps = append(apps, app)
+	}
+
+	return apps
+}
+
+func (p *AppRegistry) Default() *App {
+	return p.defaultApp
+}
+
+// Select picks the app of the request, see Resolve.
+func (p *AppRegistry) Select(r *http.Request) (*App, error) {
+	r.ParseForm()
+	return p.Resolve(r.Host, r.Form.Get(AppParam))
+}
+
+// Resolve picks the app serving host, or else the app named name, or else the default app.
+// The host mapping is authoritative: on the host of an app, naming another app fails with
+// ERROR_APP_NOT_FOUND, so the clients of one tenant cannot reach the data of another.
+func (p *AppRegistry) Resolve(host string, name string) (*App, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if app, ok := p.byHost[strings.ToLower(host)]; ok {
+		if name != "" && name != app.Name {
+			return nil, NewError(ERROR_APP_NOT_FOUND, "[AppRegistry.Resolve] app not served on host. app=%v host=%v", name, host)
+		}
+		return app, nil
+	}
+
+	if name != "" {
+		return p.Named(name)
+	}
+
+	return p.defaultApp, nil
+}
+
+// Named returns the app named name, or ERROR_APP_NOT_FOUND.
+func (p *AppRegistry) Named(name string) (*App, error) {
+	app, ok := p.byName[name]
+	if !ok {
+		return nil, NewError(ERROR_APP_NOT_FOUND, "[AppRegistry.Named] unknown app. app=%v", name)
+	}
+
+	return app, nil
+}
+
+func (p *App) Collection(session *mgo.Session) *mgo.Collection {
+	return session.DB(p.DbName).C(p.CollName)
+}
+
+// withApp selects the app of the request and attaches it to the request context.
+func withApp() Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			app, err := gobalApps.Select(r)
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), appContextKey, app)
+			ctx = context.WithValue(ctx, loggerContextKey, requestLogger(ctx).WithField("app", app.Name))
+			fn(w, r.WithContext(ctx))
+		}
+	}
+}
+
+// appFromContext returns the app selected by withApp, or the default app.
+func appFromContext(ctx context.Context) *App {
+	if app, ok := ctx.Value(appContextKey).(*App); ok {
+		return app
+	}
+
+	return gobalApps.Default()
+}
+
+func validateApps(cfg Config) []string {
+	var problems []string
+	names := map[string]bool{DefaultAppName: true}
+	hosts := make(map[string]string)
+
+	for i, app := range cfg.Apps {
+		switch {
+		case app.Name == "":
+			problems = append(problems, fmt.Sprintf("apps[%v].name is required", i))
+		case names[app.Name]:
+			problems = append(problems, fmt.Sprintf("apps[%v].name %q is used twice or is reserved", i, app.Name))
+		}
+		names[app.Name] = true
+
+		if app.DbName == "" {
+			problems = append(problems, fmt.Sprintf("apps[%v].db_name is required", i))
+		}
+		if app.CoinsPerFollower < 0 {
+			problems = append(problems, fmt.Sprintf("apps[%v].coins_per_follower must not be negative", i))
+		}
+
+		for _, host := range app.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := hosts[host]; ok {
+				problems = append(problems, fmt.Sprintf("apps[%v] host %v is already served by app %v", i, host, other))
+			}
+			hosts[host] = app.Name
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Suite(&AppSuite{})
+
+type AppSuite struct {
+	apps *AppRegistry
+}
+
+func (p *AppSuite) SetUpTest(c *C) {
+	p.apps = NewAppRegistry(Config{
+		DbName:   "follower",
+		CollName: "user",
+		Apps: []AppConfig{
+			{Name: "likes", Hosts: []string{"Likes.example.com"}, DbName: "likes"},
+			{Name: "views", Hosts: []string{"views.example.com"}, DbName: "views", CollName: "viewers"},
+		},
+	})
+}
+
+func (p *AppSuite) Test_NewAppRegistry(c *C) {
+	c.Assert(p.apps.All(), HasLen, 3)
+	c.Assert(p.apps.Default().DbName, Equals, "follower")
+
+	likes, err := p.apps.Named("likes")
+	c.Assert(err, IsNil)
+	c.Assert(likes.CollName, Equals, "user")
+	views, _ := p.apps.Named("views")
+	c.Assert(views.CollName, Equals, "viewers")
+}
+
+func (p *AppSuite) Test_Resolve_byHost(c *C) {
+	app, err := p.apps.Resolve("likes.example.com:8080", "")
+	c.Assert(err, IsNil)
+	c.Assert(app.Name, Equals, "likes")
+
+	app, err = p.apps.Resolve("LIKES.example.com", "likes")
+	c.Assert(err, IsNil)
+	c.Assert(app.Name, Equals, "likes")
+}
+
+func (p *AppSuite) Test_Resolve_otherAppOnHost(c *C) {
+	_, err := p.apps.Resolve("likes.example.com", "views")
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_APP_NOT_FOUND)
+
+	_, err = p.apps.Resolve("likes.example.com", DefaultAppName)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_APP_NOT_FOUND)
+}
+
+func (p *AppSuite) Test_Resolve_defaultHost(c *C) {
+	app, err := p.apps.Resolve("follower.example.com", "")
+	c.Assert(err, IsNil)
+	c.Assert(app, Equals, p.apps.Default())
+
+	app, err = p.apps.Resolve("follower.example.com", "views")
+	c.Assert(err, IsNil)
+	c.Assert(app.Name, Equals, "views")
+
+	_, err = p.apps.Resolve("follower.example.com", "unknown")
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_APP_NOT_FOUND)
+}
+
+func (p *AppSuite) Test_withApp(c *C) {
+	gobalApps = p.apps
+	var selected string
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {
+		selected = appFromContext(r.Context()).Name
+	}, withApp())
+
+	r := httptest.NewRequest("GET", "https://views.example.com/getfollowers/info?userId=000000001", nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	c.Assert(selected, Equals, "views")
+
+	selected = ""
+	r = httptest.NewRequest("GET", "https://views.example.com/getfollowers/info?userId=000000001&app=likes", nil)
+	w = httptest.NewRecorder()
+	handler(w, r)
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+	c.Assert(selected, Equals, "")
+}
+
+func (p *AppSuite) Test_validateApps(c *C) {
+	problems := validateApps(Config{Apps: []AppConfig{
+		{Name: "likes", Hosts: []string{"likes.example.com"}, DbName: "likes"},
+		{Name: "likes", Hosts: []string{"LIKES.example.com"}},
+		{Name: DefaultAppName, DbName: "default", CoinsPerFollower: -1},
+		{DbName: "unnamed"},
+	}})
+
+	c.Assert(problems, DeepEquals, []string{
+		`apps[1].name "likes" is used twice or is reserved`,
+		"apps[1].db_name is required",
+		"apps[1] host likes.example.com is already served by app likes",
+		`apps[2].name "default" is used twice or is reserved`,
+		"apps[2].coins_per_follower must not be negative",
+		"apps[3].name is required",
+	})
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// BreakerConfig opens the circuit breaker of mongodb after FailureThreshold consecutive
+// failures. While open, mongodb operations fail fast with ERROR_DB_UNAVAILABLE; after
+// OpenTimeout one probe operation is let through. FailureThreshold of 0 disables it.
+type BreakerConfig struct {
+	FailureThreshold int           `yaml:"failure_threshold"`
+	OpenTimeout      time.Duration `yaml:"open_timeout"`
+}
+
+type BreakerState int32
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (p BreakerState) String() string {
+	switch p {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "halfOpen"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int32(p))
+	}
+}
+
+type CircuitBreaker struct {
+	mutex      sync.Mutex
+	config     BreakerConfig
+	state      BreakerState
+	failures   int
+	openedAt   time.Time
+	probeStart time.Time
+	trips      int64
+	now        func() time.Time
+}
+
+var gobalDbBreaker = NewCircuitBreaker(BreakerConfig{}, time.Now)
+
+func NewCircuitBreaker(config BreakerConfig, now func() time.Time) *CircuitBreaker {
+	return &CircuitBreaker{config: config, now: now}
+}
+
+func initDbBreaker() {
+	gobalDbBreaker = NewCircuitBreaker(gobalConfig.DbBreaker, time.Now)
+}
+
+// Allow reports whether an operation may run. Once OpenTimeout has passed, an open breaker
+// turns half open and lets one probe through at a time; a probe which never reports back
+// is replaced after another OpenTimeout.
+func (p *CircuitBreaker) Allow() bool {
+	if p.config.FailureThreshold <= 0 {
+		return true
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	switch p.state {
+	case BreakerOpen:
+		if now.Sub(p.openedAt) < p.config.OpenTimeout {
+			return false
+		}
+		p.state = BreakerHalfOpen
+		p.probeStart = now
+		log.Infof("[CircuitBreaker.Allow] half open, probing mongodb.")
+		return true
+	case BreakerHalfOpen:
+		if now.Sub(p.probeStart) < p.config.OpenTimeout {
+			return false
+		}
+		p.probeStart = now
+		return true
+	default:
+		return true
+	}
+}
+
+// Record counts the result of an operation. Any success closes the breaker.
+func (p *CircuitBreaker) Record(err error) {
+	if p.config.FailureThreshold <= 0 {
+		return
+	}
+
+	failed := isDbFailure(err)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !failed {
+		if p.state != BreakerClosed {
+			log.Infof("[CircuitBreaker.Record] closed, mongodb is back.")
+		}
+		p.state = BreakerClosed
+		p.failures = 0
+		return
+	}
+
+	p.failures++
+	if p.state == BreakerHalfOpen || (p.state == BreakerClosed && p.failures >= p.config.FailureThreshold) {
+		p.state = BreakerOpen
+		p.openedAt = p.now()
+		atomic.AddInt64(&p.trips, 1)
+		log.Errorf("[CircuitBreaker.Record] open for %v after %v failures. error=%v", p.config.OpenTimeout, p.failures, err)
+	}
+}
+
+func (p *CircuitBreaker) State() BreakerState {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.state
+}
+
+// Trips returns how many times the breaker opened.
+func (p *CircuitBreaker) Trips() int64 {
+	return atomic.LoadInt64(&p.trips)
+}
+
+func validateBreaker(breaker BreakerConfig) []string {
+	var problems []string
+	if breaker.FailureThreshold < 0 {
+		problems = append(problems, fmt.Sprintf("db_breaker.failure_threshold must not be negative, got %v", breaker.FailureThreshold))
+	}
+	if breaker.FailureThreshold > 0 && breaker.OpenTimeout <= 0 {
+		problems = append(problems, fmt.Sprintf("db_breaker.open_timeout must be positive, got %v", breaker.OpenTimeout))
+	}
+
+	return problems
+}
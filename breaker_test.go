@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	. "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2"
+	"time"
+)
+
+var _ = Suite(&BreakerSuite{})
+
+type BreakerSuite struct{}
+
+func (p *BreakerSuite) Test_CircuitBreaker(c *C) {
+	now := time.Unix(0, 0)
+	breaker := NewCircuitBreaker(BreakerConfig{FailureThreshold: 2, OpenTimeout: time.Second}, func() time.Time { return now })
+	failure := errors.New("no reachable servers")
+
+	breaker.Record(failure)
+	breaker.Record(mgo.ErrNotFound)
+	breaker.Record(failure)
+	c.Assert(breaker.State(), Equals, BreakerClosed)
+
+	breaker.Record(failure)
+	c.Assert(breaker.State(), Equals, BreakerOpen)
+	c.Assert(breaker.Allow(), Equals, false)
+
+	now = now.Add(time.Second)
+	c.Assert(breaker.Allow(), Equals, true)
+	c.Assert(breaker.State(), Equals, BreakerHalfOpen)
+	c.Assert(breaker.Allow(), Equals, false)
+
+	breaker.Record(failure)
+	c.Assert(breaker.State(), Equals, BreakerOpen)
+	c.Assert(breaker.Trips(), Equals, int64(2))
+
+	now = now.Add(time.Second)
+	c.Assert(breaker.Allow(), Equals, true)
+	breaker.Record(nil)
+	c.Assert(breaker.State(), Equals, BreakerClosed)
+	c.Assert(breaker.Allow(), Equals, true)
+}
+
+func (p *BreakerSuite) Test_CircuitBreaker_disabled(c *C) {
+	breaker := NewCircuitBreaker(BreakerConfig{}, time.Now)
+	for i := 0; i < 10; i++ {
+		breaker.Record(errors.New("no reachable servers"))
+	}
+
+	c.Assert(breaker.Allow(), Equals, true)
+	c.Assert(breaker.State(), Equals, BreakerClosed)
+}
+
+func (p *BreakerSuite) Test_backoff(c *C) {
+	retry := RetryConfig{MaxAttempts: 5, BaseDelay: 10 * time.Millisecond, MaxDelay: 30 * time.Millisecond}
+
+	for i := 0; i < 100; i++ {
+		c.Assert(backoff(retry, 1) <= 10*time.Millisecond, Equals, true)
+		c.Assert(backoff(retry, 4) <= 30*time.Millisecond, Equals, true)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"container/list"
+	"gopkg.in/mgo.v2/bson"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// UserCache keeps the latest results of queryInfo and queryProgress, up to capacity entries
+// in least recently used order. They are only served while mongodb is unavailable.
+type UserCache struct {
+	mutex    sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List
+	stale    int64
+}
+
+type cacheEntry struct {
+	key      string
+	value    bson.M
+	cachedAt time.Time
+}
+
+var gobalUserCache = NewUserCache(0)
+
+func NewUserCache(capacity int) *UserCache {
+	return &UserCache{capacity: capacity, entries: make(map[string]*list.Element), order: list.New()}
+}
+
+func initUserCache() {
+	gobalUserCache = NewUserCache(gobalConfig.UserCacheSize)
+}
+
+func userCacheKey(app *App, kind string, userId string) string {
+	return app.Name + "|" + kind + "|" + userId
+}
+
+func (p *UserCache) Put(key string, value bson.M) {
+	if p.capacity <= 0 {
+		return
+	}
+
+	copied := make(bson.M, len(value))
+	for k, v := range value {
+		copied[k] = v
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if element, ok := p.entries[key]; ok {
+		element.Value = &cacheEntry{key, copied, time.Now()}
+		p.order.MoveToFront(element)
+		return
+	}
+
+	p.entries[key] = p.order.PushFront(&cacheEntry{key, copied, time.Now()})
+	if p.order.Len() > p.capacity {
+		oldest := p.order.Remove(p.order.Back()).(*cacheEntry)
+		delete(p.entries, oldest.key)
+	}
+}
+
+// Get returns a copy of the cached value and when it was cached.
+func (p *UserCache) Get(key string) (bson.M, time.Time, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	element, ok := p.entries[key]
+	if !ok {
+		return nil, time.Time{}, false
+	}
+	p.order.MoveToFront(element)
+
+	entry := element.Value.(*cacheEntry)
+	copied := make(bson.M, len(entry.value)+2)
+	for k, v := range entry.value {
+		copied[k] = v
+	}
+
+	return copied, entry.cachedAt, true
+}
+
+func (p *UserCache) Remove(keys ...string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	for _, key := range keys {
+		if element, ok := p.entries[key]; ok {
+			p.order.Remove(element)
+			delete(p.entries, key)
+		}
+	}
+}
+
+func (p *UserCache) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.order.Len()
+}
+
+// Stale returns how many cached results were served in place of mongodb.
+func (p *UserCache) Stale() int64 {
+	return atomic.LoadInt64(&p.stale)
+}
+
+// cachedQuery runs query and caches its result under key. If mongodb is unavailable it
+// serves the cached result instead, marked with stale and cachedAt.
+func (p *UserCache) cachedQuery(key string, query func() (bson.M, error)) (bson.M, error) {
+	result, err := query()
+	if err == nil {
+		p.Put(key, result)
+		return result, nil
+	}
+
+	if !isDbUnavailable(err) {
+		return nil, err
+	}
+
+	cached, cachedAt, ok := p.Get(key)
+	if !ok {
+		return nil, err
+	}
+
+	atomic.AddInt64(&p.stale, 1)
+	cached["stale"] = true
+	cached["cachedAt"] = cachedAt.Unix()
+	return cached, nil
+}
+
+// isDbUnavailable reports whether err is a failure of mongodb itself rather than an answer.
+func isDbUnavailable(err error) bool {
+	e, ok := err.(FollowerError)
+	if !ok {
+		return false
+	}
+
+	switch e.Code {
+	case ERROR_DB_UNAVAILABLE, ERROR_DB_OPERATE_FAIELD, ERROR_TIMEOUT:
+		return true
+	default:
+		return false
+	}
+}
+
+// checkWritable rejects writes with ERROR_READ_ONLY while the circuit breaker of mongodb
+// is open. Reads keep being served, from the cache if need be.
+func checkWritable() error {
+	if gobalDbBreaker.State() == BreakerOpen {
+		return NewError(ERROR_READ_ONLY, "[checkWritable] read only while the database is unavailable, please retry later.")
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+)
+
+var _ = Suite(&CacheSuite{})
+
+type CacheSuite struct{}
+
+func (p *CacheSuite) Test_UserCache_evictLeastRecentlyUsed(c *C) {
+	cache := NewUserCache(2)
+	cache.Put("a", bson.M{"coins": 1})
+	cache.Put("b", bson.M{"coins": 2})
+	cache.Get("a")
+	cache.Put("c", bson.M{"coins": 3})
+
+	_, _, ok := cache.Get("b")
+	c.Assert(ok, Equals, false)
+	value, _, ok := cache.Get("a")
+	c.Assert(ok, Equals, true)
+	c.Assert(value["coins"], Equals, 1)
+	c.Assert(cache.Len(), Equals, 2)
+}
+
+func (p *CacheSuite) Test_cachedQuery_serveStaleWhenDbUnavailable(c *C) {
+	cache := NewUserCache(10)
+	result, err := cache.cachedQuery("info", func() (bson.M, error) {
+		return bson.M{"userId": "000000001", "coins": 5}, nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result["stale"], IsNil)
+
+	result, err = cache.cachedQuery("info", func() (bson.M, error) {
+		return nil, NewError(ERROR_DB_UNAVAILABLE, "down")
+	})
+	c.Assert(err, IsNil)
+	c.Assert(result["coins"], Equals, 5)
+	c.Assert(result["stale"], Equals, true)
+	c.Assert(cache.Stale(), Equals, int64(1))
+
+	_, err = cache.cachedQuery("info", func() (bson.M, error) {
+		return nil, NewError(ERROR_USER_NOT_FOUND, "not found")
+	})
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_USER_NOT_FOUND)
+
+	_, err = cache.cachedQuery("progress", func() (bson.M, error) {
+		return nil, NewError(ERROR_DB_UNAVAILABLE, "down")
+	})
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_DB_UNAVAILABLE)
+}
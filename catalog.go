@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultLang = "en"
+	LangParam   = "lang"
+)
+
+// ErrorCatalogEntry describes an error code to the clients. Name is stable and Messages
+// holds the client message by language.
+type ErrorCatalogEntry struct {
+	Code        int               `json:"code"`
+	Name        string            `json:"name"`
+	Status      int               `json:"status"`
+	Description string            `json:"description"`
+	Message     string            `json:"message,omitempty"`
+	Messages    map[string]string `json:"messages"`
+}
+
+// ErrorCatalogResponse is the response of errorCatalogHandler.
+type ErrorCatalogResponse struct {
+	Lang      string              `json:"lang"`
+	Languages []string            `json:"languages"`
+	Errors    []ErrorCatalogEntry `json:"errors"`
+}
+
+var errorCatalog = []ErrorCatalogEntry{
+	{Code: ERROR_INTERNAL, Name: "INTERNAL", Status: http.StatusInternalServerError,
+		Description: "An unexpected server failure.",
+		Messages:    map[string]string{"en": "internal error", "zh": "服务器内部错误"}},
+	{Code: ERROR_DB_OPERATE_FAIELD, Name: "DB_OPERATE_FAILED", Status: http.StatusServiceUnavailable,
+		Description: "A database operation failed. Retrying later may succeed.",
+		Messages:    map[string]string{"en": "database operation failed, please retry later", "zh": "数据库操作失败，请稍后重试"}},
+	{Code: ERROR_URL_PARAM_INVALID, Name: "URL_PARAM_INVALID", Status: http.StatusBadRequest,
+		Description: "A request parameter is missing or invalid.",
+		Messages:    map[string]string{"en": "invalid url parameter", "zh": "请求参数无效"}},
+	{Code: ERROR_NO_BUYER, Name: "NO_BUYER", Status: http.StatusNotFound,
+		Description: "getuser found no pending order to follow.",
+		Messages:    map[string]string{"en": "no buyer at the moment", "zh": "暂时没有购买者"}},
+	{Code: ERROR_USER_NOT_FOUND, Name: "USER_NOT_FOUND", Status: http.StatusNotFound,
+		Description: "The userId is unknown.",
+		Messages:    map[string]string{"en": "user not found", "zh": "用户不存在"}},
+	{Code: ERROR_APP_NOT_FOUND, Name: "APP_NOT_FOUND", Status: http.StatusNotFound,
+		Description: "The app parameter names no configured app, or another app than the one served on the host of the request.",
+		Messages:    map[string]string{"en": "app not found", "zh": "应用不存在"}},
+	{Code: ERROR_CLIENT_CERT_REQUIRED, Name: "CLIENT_CERT_REQUIRED", Status: http.StatusForbidden,
+		Description: "The admin listener requires a verified client certificate.",
+		Messages:    map[string]string{"en": "client certificate required", "zh": "需要客户端证书"}},
+	{Code: ERROR_RATE_LIMITED, Name: "RATE_LIMITED", Status: http.StatusTooManyRequests,
+		Description: "The user or ip sent too many requests. Retry after the Retry-After header.",
+		Messages:    map[string]string{"en": "too many requests", "zh": "请求过于频繁"}},
+	{Code: ERROR_SERVER_BUSY, Name: "SERVER_BUSY", Status: http.StatusServiceUnavailable,
+		Description: "The server is at its concurrency limit. Retry after the Retry-After header.",
+		Messages:    map[string]string{"en": "server busy, please retry later", "zh": "服务器繁忙，请稍后重试"}},
+	{Code: ERROR_TIMEOUT, Name: "TIMEOUT", Status: http.StatusGatewayTimeout,
+		Description: "The request exceeded its deadline.",
+		Messages:    map[string]string{"en": "request timed out", "zh": "请求超时"}},
+	{Code: ERROR_DB_UNAVAILABLE, Name: "DB_UNAVAILABLE", Status: http.StatusServiceUnavailable,
+		Description: "The database is unavailable and requests fail fast until it recovers.",
+		Messages:    map[string]string{"en": "database unavailable, please retry later", "zh": "数据库不可用，请稍后重试"}},
+	{Code: ERROR_READ_ONLY, Name: "READ_ONLY", Status: http.StatusServiceUnavailable,
+		Description: "Writes are rejected while the database is unavailable. Reads may be served stale.",
+		Messages:    map[string]string{"en": "read only while the database is unavailable, please retry later", "zh": "数据库不可用，暂时只读，请稍后重试"}},
+	{Code: ERROR_MAINTENANCE, Name: "MAINTENANCE", Status: http.StatusServiceUnavailable,
+		Description: "The route is under maintenance. The message may tell the expected end.",
+		Messages:    map[string]string{"en": "service under maintenance", "zh": "服务维护中"}},
+	{Code: ERROR_ROUTE_NOT_FOUND, Name: "ROUTE_NOT_FOUND", Status: http.StatusNotFound,
+		Description: "No route of the api has the requested path.",
+		Messages:    map[string]string{"en": "route not found", "zh": "接口不存在"}},
+	{Code: ERROR_METHOD_NOT_ALLOWED, Name: "METHOD_NOT_ALLOWED", Status: http.StatusMethodNotAllowed,
+		Description: "The route does not accept the request method. The Allow header lists the methods it accepts.",
+		Messages:    map[string]string{"en": "method not allowed", "zh": "请求方法不允许"}},
+	{Code: ERROR_VERSION_UNSUPPORTED, Name: "VERSION_UNSUPPORTED", Status: http.StatusBadRequest,
+		Description: "The version parameter names no known api version.",
+		Messages:    map[string]string{"en": "unsupported api version", "zh": "不支持的接口版本"}},
+	{Code: ERROR_VERSION_RETIRED, Name: "VERSION_RETIRED", Status: http.StatusGone,
+		Description: "The api version is retired or past its Sunset date. Deprecated versions announce it with the Deprecation and Sunset headers.",
+		Messages:    map[string]string{"en": "this api version is retired, please upgrade", "zh": "该接口版本已停用，请升级"}},
+	{Code: ERROR_UPGRADE_REQUIRED, Name: "UPGRADE_REQUIRED", Status: http.StatusUpgradeRequired,
+		Description: "The version parameter is below min_version.",
+		Messages:    map[string]string{"en": "client version too old, please upgrade", "zh": "客户端版本过低，请升级"}},
+	{Code: ERROR_IDEMPOTENCY_IN_PROGRESS, Name: "IDEMPOTENCY_IN_PROGRESS", Status: http.StatusConflict,
+		Description: "A request with the same Idempotency-Key is still running. Retry after it completes.",
+		Messages:    map[string]string{"en": "a request with this idempotency key is in progress", "zh": "相同幂等键的请求正在处理中"}},
+	{Code: ERROR_IDEMPOTENCY_KEY_REUSED, Name: "IDEMPOTENCY_KEY_REUSED", Status: http.StatusUnprocessableEntity,
+		Description: "The Idempotency-Key was used by a request with other parameters.",
+		Messages:    map[string]string{"en": "idempotency key reused with other parameters", "zh": "幂等键已被其他参数的请求使用"}},
+	{Code: ERROR_IDEMPOTENCY_UNKNOWN, Name: "IDEMPOTENCY_UNKNOWN", Status: http.StatusConflict,
+		Description: "The request with the same Idempotency-Key failed and may have been applied, and its response cannot be replayed. Check the result before sending the request again with a new key.",
+		Messages:    map[string]string{"en": "the request with this idempotency key may have been applied, please check before retrying", "zh": "相同幂等键的请求可能已执行，请确认后再重试"}},
+	{Code: ERROR_UNSUPPORTED_MEDIA_TYPE, Name: "UNSUPPORTED_MEDIA_TYPE", Status: http.StatusUnsupportedMediaType,
+		Description: "The body of a v2 POST route is not sent as application/json.",
+		Messages:    map[string]string{"en": "the request body must be application/json", "zh": "请求体必须是 application/json"}},
+	{Code: ERROR_INSUFFICIENT_COINS, Name: "INSUFFICIENT_COINS", Status: http.StatusPaymentRequired,
+		Description: "The coins spent by buyfollower exceed the coins of the user.",
+		Messages:    map[string]string{"en": "not enough coins", "zh": "金币不足"}},
+}
+
+var errorCatalogByCode = indexErrorCatalog(errorCatalog)
+
+func indexErrorCatalog(catalog []ErrorCatalogEntry) map[int]ErrorCatalogEntry {
+	byCode := make(map[int]ErrorCatalogEntry, len(catalog))
+	for _, entry := range catalog {
+		byCode[entry.Code] = entry
+	}
+
+	return byCode
+}
+
+// catalogLangs returns the languages with a message for every error code.
+func catalogLangs() []string {
+	var langs []string
+	for lang := range errorCatalog[0].Messages {
+		complete := true
+		for _, entry := range errorCatalog {
+			if _, ok := entry.Messages[lang]; !ok {
+				complete = false
+			}
+		}
+		if complete {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs)
+
+	return langs
+}
+
+// requestLang picks the language of the client messages from the lang parameter, or else
+// the Accept-Language header, or else DefaultLang. Only the primary subtag is matched, so
+// zh-CN selects zh.
+func requestLang(r *http.Request) string {
+	supported := make(map[string]bool)
+	for _, lang := range catalogLangs() {
+		supported[lang] = true
+	}
+
+	if lang := primaryLang(r.URL.Query().Get(LangParam)); supported[lang] {
+		return lang
+	}
+
+	best, bestQ := DefaultLang, 0.0
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		fields := strings.Split(part, ";")
+		lang := primaryLang(fields[0])
+		q := 1.0
+		for _, param := range fields[1:] {
+			if param = strings.TrimSpace(param); strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+
+		if supported[lang] && q > bestQ {
+			best, bestQ = lang, q
+		}
+	}
+
+	return best
+}
+
+func primaryLang(tag string) string {
+	return strings.ToLower(strings.Split(strings.TrimSpace(tag), "-")[0])
+}
+
+// localize translates the client message of e into lang, unless it is a custom message.
+func localize(e FollowerError, lang string) FollowerError {
+	entry, ok := errorCatalogByCode[e.Code]
+	if !ok || e.Msg != entry.Messages[DefaultLang] {
+		return e
+	}
+
+	if msg, ok := entry.Messages[lang]; ok {
+		e.Msg = msg
+	}
+
+	return e
+}
+
+// errorCatalogHandler lists the error catalog, with the message of each entry in the
+// language of the request.
+func errorCatalogHandler(w http.ResponseWriter, r *http.Request) error {
+	lang := requestLang(r)
+	entries := make([]ErrorCatalogEntry, 0, len(errorCatalog))
+	for _, entry := range errorCatalog {
+		entry.Message = entry.Messages[lang]
+		entries = append(entries, entry)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Language", lang)
+	return json.NewEncoder(w).Encode(ErrorCatalogResponse{lang, catalogLangs(), entries})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	. "gopkg.in/check.v1"
+	"net/http/httptest"
+)
+
+var _ = Suite(&CatalogSuite{})
+
+type CatalogSuite struct{}
+
+func (p *CatalogSuite) Test_errorCatalog_complete(c *C) {
+	names := make(map[string]bool)
+	for _, entry := range errorCatalog {
+		c.Assert(names[entry.Name], Equals, false, Commentf("name %v is used twice", entry.Name))
+		names[entry.Name] = true
+	}
+
+	c.Assert(catalogLangs(), DeepEquals, []string{"en", "zh"})
+}
+
+func (p *CatalogSuite) Test_requestLang(c *C) {
+	r := httptest.NewRequest("GET", "/getfollowers/info", nil)
+	c.Assert(requestLang(r), Equals, DefaultLang)
+
+	r.Header.Set("Accept-Language", "fr;q=1, zh-CN;q=0.8, en;q=0.5")
+	c.Assert(requestLang(r), Equals, "zh")
+
+	r = httptest.NewRequest("GET", "/getfollowers/info?lang=en", nil)
+	r.Header.Set("Accept-Language", "zh")
+	c.Assert(requestLang(r), Equals, "en")
+}
+
+func (p *CatalogSuite) Test_writeError_localized(c *C) {
+	r := httptest.NewRequest("GET", "/getfollowers/info?lang=zh", nil)
+	w := httptest.NewRecorder()
+	writeError(w, r, NewError(ERROR_USER_NOT_FOUND, "[queryInfo] not found"))
+
+	var e FollowerError
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &e), IsNil)
+	c.Assert(e.Msg, Equals, "用户不存在")
+	c.Assert(e.Name, Equals, "USER_NOT_FOUND")
+	c.Assert(w.Header().Get("Content-Language"), Equals, "zh")
+
+	w = httptest.NewRecorder()
+	writeError(w, r, NewErrorMsg(ERROR_MAINTENANCE, "back at noon", "[test]"))
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &e), IsNil)
+	c.Assert(e.Msg, Equals, "back at noon")
+}
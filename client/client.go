@@ -0,0 +1,405 @@
+// Package client is the Go client of the follower api. It calls the v2 routes, retries the
+// temporary failures, and sends an Idempotency-Key with the writes so that a retried write
+// is applied once.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	mrand "math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultTimeout     = 10 * time.Second
+	DefaultMaxAttempts = 3
+	DefaultBaseDelay   = 100 * time.Millisecond
+	DefaultMaxDelay    = 2 * time.Second
+
+	IdempotencyKeyHeader = "Idempotency-Key"
+)
+
+// RetryConfig retries the temporary failures up to MaxAttempts times in all, waiting the
+// Retry-After of the response, or else a random delay below BaseDelay*2^attempt capped at
+// MaxDelay. A Retry-After longer than MaxDelay is not waited for. MaxAttempts of 1 disables
+// retries.
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+// TLSConfig configures https. CAFile verifies the server instead of the system roots, and
+// CertFile and KeyFile present a client certificate.
+type TLSConfig struct {
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	retry      RetryConfig
+	app        string
+	lang       string
+	userAgent  string
+}
+
+type Option func(*Client) error
+
+// WithHTTPClient replaces the http client, including its timeout and transport.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) error {
+		c.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithTimeout bounds every attempt of a call.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) error {
+		c.httpClient.Timeout = timeout
+		return nil
+	}
+}
+
+func WithTLS(config TLSConfig) Option {
+	return func(c *Client) error {
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return err
+		}
+
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = tlsConfig
+		c.httpClient.Transport = transport
+		return nil
+	}
+}
+
+func WithRetry(retry RetryConfig) Option {
+	return func(c *Client) error {
+		if retry.MaxAttempts < 1 || retry.BaseDelay < 0 || retry.MaxDelay < 0 {
+			return fmt.Errorf("follower: invalid retry config %+v", retry)
+		}
+		c.retry = retry
+		return nil
+	}
+}
+
+// WithApp selects the tenant app of the calls.
+func WithApp(app string) Option {
+	return func(c *Client) error {
+		c.app = app
+		return nil
+	}
+}
+
+// WithLang asks for the error messages in lang.
+func WithLang(lang string) Option {
+	return func(c *Client) error {
+		c.lang = lang
+		return nil
+	}
+}
+
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) error {
+		c.userAgent = userAgent
+		return nil
+	}
+}
+
+// New returns a client of the server at baseURL, e.g. https://follower.example.com:8080.
+func New(baseURL string, options ...Option) (*Client, error) {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("follower: invalid base url %q: %v", baseURL, err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("follower: base url %q must be http or https", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		retry:      RetryConfig{DefaultMaxAttempts, DefaultBaseDelay, DefaultMaxDelay},
+		userAgent:  "follower-go-client",
+	}
+	for _, option := range options {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+type OrderProgress struct {
+	Fans     int64 `json:"fans"`
+	Progress int64 `json:"progress"`
+	Status   bool  `json:"status"`
+}
+
+// ProgressResponse is the response of Progress. Stale is set with the time the result was
+// cached, in CachedAt, when the server answers from its cache while its database is down.
+type ProgressResponse struct {
+	UserId   string          `json:"userId"`
+	Orders   []OrderProgress `json:"orders"`
+	Stale    bool            `json:"stale"`
+	CachedAt int64           `json:"cachedAt"`
+}
+
+// InfoResponse is the response of Info, see ProgressResponse for Stale.
+type InfoResponse struct {
+	UserId   string          `json:"userId"`
+	Coins    int64           `json:"coins"`
+	Orders   []OrderProgress `json:"orders"`
+	Stale    bool            `json:"stale"`
+	CachedAt int64           `json:"cachedAt"`
+}
+
+type CoinsResponse struct {
+	UserId string `json:"userId"`
+	Coins  int64  `json:"coins"`
+}
+
+type BuyFollowerResponse struct {
+	Coins int64 `json:"coins"`
+}
+
+type GetUserResponse struct {
+	UserIds []string `json:"userIDs"`
+}
+
+// Coins adds coins, which may be negative, to the user and returns the new balance.
+func (c *Client) Coins(ctx context.Context, userId string, coins int64) (*CoinsResponse, error) {
+	var resp CoinsResponse
+	body := map[string]interface{}{"userId": userId, "coins": coins}
+	if err := c.call(ctx, http.MethodPost, "/v2/coins", nil, body, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// Info returns the coins and orders of the user, who is created if unknown.
+func (c *Client) Info(ctx context.Context, userId string) (*InfoResponse, error) {
+	var resp InfoResponse
+	if err := c.call(ctx, http.MethodGet, "/v2/info", url.Values{"userId": {userId}}, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// BuyFollower spends coins of the user on value followers and returns the remaining coins.
+func (c *Client) BuyFollower(ctx context.Context, userId string, coins int64, value int64) (*BuyFollowerResponse, error) {
+	var resp BuyFollowerResponse
+	body := map[string]interface{}{"userId": userId, "coins": coins, "value": value}
+	if err := c.call(ctx, http.MethodPost, "/v2/buyfollower", nil, body, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// GetUser returns the buyers the user should follow next. It fails with ERROR_NO_BUYER if
+// there is none.
+func (c *Client) GetUser(ctx context.Context, userId string) (*GetUserResponse, error) {
+	var resp GetUserResponse
+	body := map[string]interface{}{"userId": userId}
+	if err := c.call(ctx, http.MethodPost, "/v2/getuser", nil, body, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// Progress returns the orders of the user.
+func (c *Client) Progress(ctx context.Context, userId string) (*ProgressResponse, error) {
+	var resp ProgressResponse
+	if err := c.call(ctx, http.MethodGet, "/v2/progress", url.Values{"userId": {userId}}, nil, &resp); err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// call sends the request, retrying it per RetryConfig, and decodes the response into resp.
+// A POST carries the same Idempotency-Key in every attempt.
+func (c *Client) call(ctx context.Context, method string, path string, query url.Values, body interface{}, resp interface{}) error {
+	if query == nil {
+		query = url.Values{}
+	}
+	if c.app != "" {
+		query.Set("app", c.app)
+	}
+	u := c.baseURL.ResolveReference(&url.URL{Path: path, RawQuery: query.Encode()})
+
+	var payload []byte
+	var idempotencyKey string
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("follower: json.Marshal failed: %v", err)
+		}
+		if idempotencyKey, err = newIdempotencyKey(); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	for attempt := 0; attempt < c.retry.MaxAttempts; attempt++ {
+		var retryAfter time.Duration
+		var temporary bool
+		retryAfter, temporary, err = c.do(ctx, method, u.String(), payload, idempotencyKey, resp)
+		if err == nil || !temporary || attempt+1 == c.retry.MaxAttempts {
+			break
+		}
+
+		wait := retryAfter
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		} else if wait > c.retry.MaxDelay {
+			break
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
+
+// do sends one attempt, and reports whether its failure is temporary.
+func (c *Client) do(ctx context.Context, method string, u string, payload []byte, idempotencyKey string, resp interface{}) (time.Duration, bool, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return 0, false, fmt.Errorf("follower: %v", err)
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", c.userAgent)
+	if c.lang != "" {
+		req.Header.Set("Accept-Language", c.lang)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyKeyHeader, idempotencyKey)
+	}
+
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		// the server may not have seen the request, unless ctx is done.
+		return 0, ctx.Err() == nil, fmt.Errorf("follower: %v %v failed: %v", method, u, err)
+	}
+	defer res.Body.Close()
+
+	content, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, ctx.Err() == nil, fmt.Errorf("follower: read response of %v %v failed: %v", method, u, err)
+	}
+
+	if res.StatusCode >= http.StatusBadRequest {
+		e := &FollowerError{StatusCode: res.StatusCode, RetryAfter: retryAfter(res.Header.Get("Retry-After"))}
+		if err := json.Unmarshal(content, e); err != nil || e.Code == 0 {
+			// not answered by the follower server, e.g. by a proxy.
+			e.Msg = strings.TrimSpace(string(content))
+			return e.RetryAfter, res.StatusCode >= http.StatusInternalServerError, e
+		}
+		return e.RetryAfter, e.temporary(payload != nil), e
+	}
+
+	if err := json.Unmarshal(content, resp); err != nil {
+		return 0, false, fmt.Errorf("follower: decode response of %v %v failed: %v", method, u, err)
+	}
+
+	return 0, false, nil
+}
+
+// backoff returns a random delay below BaseDelay*2^attempt, capped at MaxDelay.
+func (c *Client) backoff(attempt int) time.Duration {
+	ceiling := math.Min(float64(c.retry.MaxDelay), float64(c.retry.BaseDelay)*math.Pow(2, float64(attempt)))
+	if ceiling < 1 {
+		return 0
+	}
+
+	return time.Duration(mrand.Int63n(int64(ceiling)))
+}
+
+func retryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && time.Until(date) > 0 {
+		return time.Until(date)
+	}
+
+	return 0
+}
+
+func newIdempotencyKey() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("follower: generate idempotency key failed: %v", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func newTLSConfig(config TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+
+	if config.CAFile != "" {
+		pem, err := ioutil.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("follower: read ca file failed. file=%v error=%v", config.CAFile, err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("follower: no certificate found in ca file. file=%v", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("follower: load client certificate failed. certFile=%v keyFile=%v error=%v", config.CertFile, config.KeyFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,160 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+var _ = Suite(&ClientSuite{})
+
+type ClientSuite struct {
+	server   *httptest.Server
+	requests []recordedRequest
+}
+
+type recordedRequest struct {
+	method         string
+	path           string
+	query          string
+	idempotencyKey string
+	body           map[string]interface{}
+}
+
+func (p *ClientSuite) TearDownTest(c *C) {
+	if p.server != nil {
+		p.server.Close()
+	}
+	p.server, p.requests = nil, nil
+}
+
+// serve answers the requests with responses in turn, recording them.
+func (p *ClientSuite) serve(c *C, responses ...func(w http.ResponseWriter)) *Client {
+	p.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorded := recordedRequest{r.Method, r.URL.Path, r.URL.RawQuery, r.Header.Get(IdempotencyKeyHeader), nil}
+		if content, _ := ioutil.ReadAll(r.Body); len(content) != 0 {
+			json.Unmarshal(content, &recorded.body)
+		}
+		p.requests = append(p.requests, recorded)
+
+		responses[len(p.requests)-1](w)
+	}))
+
+	client, err := New(p.server.URL, WithRetry(RetryConfig{3, time.Millisecond, 10 * time.Millisecond}), WithApp("likes"))
+	c.Assert(err, IsNil)
+	return client
+}
+
+func respond(status int, header string, body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		if header != "" {
+			w.Header().Set("Retry-After", header)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}
+}
+
+func (p *ClientSuite) Test_Coins(c *C) {
+	client := p.serve(c, respond(http.StatusOK, "", `{"userId": "000000001", "coins": 15}`))
+
+	resp, err := client.Coins(context.Background(), "000000001", 5)
+	c.Assert(err, IsNil)
+	c.Assert(*resp, Equals, CoinsResponse{"000000001", 15})
+
+	c.Assert(p.requests, HasLen, 1)
+	c.Assert(p.requests[0].method, Equals, "POST")
+	c.Assert(p.requests[0].path, Equals, "/v2/coins")
+	c.Assert(p.requests[0].query, Equals, "app=likes")
+	c.Assert(p.requests[0].body, DeepEquals, map[string]interface{}{"userId": "000000001", "coins": float64(5)})
+	c.Assert(p.requests[0].idempotencyKey, HasLen, 32)
+}
+
+func (p *ClientSuite) Test_Info(c *C) {
+	client := p.serve(c, respond(http.StatusOK, "", `{"userId": "000000001", "coins": 3, "orders": [{"fans": 2, "progress": 1, "status": false}]}`))
+
+	resp, err := client.Info(context.Background(), "000000001")
+	c.Assert(err, IsNil)
+	c.Assert(resp.Orders, DeepEquals, []OrderProgress{{2, 1, false}})
+
+	c.Assert(p.requests[0].method, Equals, "GET")
+	c.Assert(p.requests[0].query, Equals, "app=likes&userId=000000001")
+	c.Assert(p.requests[0].idempotencyKey, Equals, "")
+}
+
+func (p *ClientSuite) Test_retrySameIdempotencyKey(c *C) {
+	client := p.serve(c,
+		respond(http.StatusServiceUnavailable, "", `{"code": 268435465, "errName": "SERVER_BUSY", "errMsg": "server busy"}`),
+		respond(http.StatusBadGateway, "", `bad gateway`),
+		respond(http.StatusOK, "", `{"coins": 7}`))
+
+	resp, err := client.BuyFollower(context.Background(), "000000001", 3, 1)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Coins, Equals, int64(7))
+
+	c.Assert(p.requests, HasLen, 3)
+	c.Assert(p.requests[1].idempotencyKey, Equals, p.requests[0].idempotencyKey)
+	c.Assert(p.requests[2].idempotencyKey, Equals, p.requests[0].idempotencyKey)
+}
+
+func (p *ClientSuite) Test_writeTimeoutNotRetried(c *C) {
+	client := p.serve(c,
+		respond(http.StatusGatewayTimeout, "", `{"code": 268435466, "errName": "TIMEOUT", "errMsg": "request timeout"}`),
+		respond(http.StatusOK, "", `{"coins": 7}`))
+
+	resp, err := client.BuyFollower(context.Background(), "000000001", 3, 1)
+	c.Assert(resp, IsNil)
+	c.Assert(ErrorCode(err), Equals, ERROR_TIMEOUT)
+	c.Assert(p.requests, HasLen, 1)
+}
+
+func (p *ClientSuite) Test_readTimeoutRetried(c *C) {
+	client := p.serve(c,
+		respond(http.StatusGatewayTimeout, "", `{"code": 268435466, "errName": "TIMEOUT", "errMsg": "request timeout"}`),
+		respond(http.StatusOK, "", `{"userId": "000000001", "orders": []}`))
+
+	_, err := client.Progress(context.Background(), "000000001")
+	c.Assert(err, IsNil)
+	c.Assert(p.requests, HasLen, 2)
+}
+
+func (p *ClientSuite) Test_FollowerError(c *C) {
+	client := p.serve(c, respond(http.StatusBadRequest, "", `{"code": 268435459, "errName": "URL_PARAM_INVALID", "errMsg": "invalid request parameter", "violations": [{"param": "userId", "reason": "must be 9 characters long"}]}`))
+
+	resp, err := client.Progress(context.Background(), "1")
+	c.Assert(resp, IsNil)
+	c.Assert(ErrorCode(err), Equals, ERROR_URL_PARAM_INVALID)
+
+	e := err.(*FollowerError)
+	c.Assert(e.StatusCode, Equals, http.StatusBadRequest)
+	c.Assert(e.Violations, DeepEquals, []Violation{{"userId", "must be 9 characters long"}})
+
+	// not retried
+	c.Assert(p.requests, HasLen, 1)
+}
+
+func (p *ClientSuite) Test_retryAfterTooLong(c *C) {
+	client := p.serve(c, respond(http.StatusServiceUnavailable, "3600", `{"code": 268435469, "errName": "MAINTENANCE", "errMsg": "service under maintenance"}`))
+
+	_, err := client.GetUser(context.Background(), "000000001")
+	c.Assert(ErrorCode(err), Equals, ERROR_MAINTENANCE)
+	c.Assert(err.(*FollowerError).RetryAfter, Equals, time.Hour)
+	c.Assert(p.requests, HasLen, 1)
+}
+
+func (p *ClientSuite) Test_New_invalid(c *C) {
+	_, err := New("ftp://follower")
+	c.Assert(err, NotNil)
+	_, err = New("http://follower", WithRetry(RetryConfig{}))
+	c.Assert(err, NotNil)
+	_, err = New("https://follower", WithTLS(TLSConfig{CAFile: "/nonexistent"}))
+	c.Assert(err, NotNil)
+}
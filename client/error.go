@@ -0,0 +1,79 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// The error codes of the follower api, see the error catalog served on /v2/errors.
+const (
+	ERROR_INTERNAL                = 0x10000001
+	ERROR_DB_OPERATE_FAIELD       = 0x10000002
+	ERROR_URL_PARAM_INVALID       = 0x10000003
+	ERROR_NO_BUYER                = 0x10000004
+	ERROR_USER_NOT_FOUND          = 0x10000005
+	ERROR_APP_NOT_FOUND           = 0x10000006
+	ERROR_CLIENT_CERT_REQUIRED    = 0x10000007
+	ERROR_RATE_LIMITED            = 0x10000008
+	ERROR_SERVER_BUSY             = 0x10000009
+	ERROR_TIMEOUT                 = 0x1000000A
+	ERROR_DB_UNAVAILABLE          = 0x1000000B
+	ERROR_READ_ONLY               = 0x1000000C
+	ERROR_MAINTENANCE             = 0x1000000D
+	ERROR_ROUTE_NOT_FOUND         = 0x1000000E
+	ERROR_METHOD_NOT_ALLOWED      = 0x1000000F
+	ERROR_VERSION_UNSUPPORTED     = 0x10000010
+	ERROR_VERSION_RETIRED         = 0x10000011
+	ERROR_UPGRADE_REQUIRED        = 0x10000012
+	ERROR_IDEMPOTENCY_IN_PROGRESS = 0x10000013
+	ERROR_IDEMPOTENCY_KEY_REUSED  = 0x10000014
+	ERROR_IDEMPOTENCY_UNKNOWN     = 0x10000015
+	ERROR_UNSUPPORTED_MEDIA_TYPE  = 0x10000016
+	ERROR_INSUFFICIENT_COINS      = 0x10000017
+)
+
+// Violation is one invalid request parameter.
+type Violation struct {
+	Param  string `json:"param"`
+	Reason string `json:"reason"`
+}
+
+// FollowerError is an error answered by the server.
+type FollowerError struct {
+	Code       int         `json:"code"`
+	Name       string      `json:"errName,omitempty"`
+	Msg        string      `json:"errMsg"`
+	Violations []Violation `json:"violations,omitempty"`
+
+	// StatusCode is the http status of the response, and RetryAfter its Retry-After header.
+	StatusCode int           `json:"-"`
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *FollowerError) Error() string {
+	return fmt.Sprintf("follower: %v (code=0x%x status=%v)", e.Msg, e.Code, e.StatusCode)
+}
+
+// ErrorCode returns the code of err if it is a *FollowerError, or else 0.
+func ErrorCode(err error) int {
+	if e, ok := err.(*FollowerError); ok {
+		return e.Code
+	}
+
+	return 0
+}
+
+// temporary reports whether retrying the request may succeed. A write which timed out or
+// failed in the database may have been applied, and the server answers its retry with the
+// same error, so it is not retried.
+func (e *FollowerError) temporary(write bool) bool {
+	switch e.Code {
+	case ERROR_RATE_LIMITED, ERROR_SERVER_BUSY, ERROR_DB_UNAVAILABLE, ERROR_READ_ONLY,
+		ERROR_MAINTENANCE, ERROR_IDEMPOTENCY_IN_PROGRESS:
+		return true
+	case ERROR_TIMEOUT, ERROR_DB_OPERATE_FAIELD:
+		return !write
+	}
+
+	return false
+}
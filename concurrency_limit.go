@@ -0,0 +1,223 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ConcurrencyAdaptInterval = time.Second
+
+	// the limit shrinks by ConcurrencyDecreaseRatio while the latency is above target, and
+	// grows by one while it is below target and the limit is nearly used.
+	ConcurrencyDecreaseRatio = 0.9
+	ConcurrencyBusyRatio     = 0.8
+)
+
+// ConcurrencyLimitConfig bounds the client requests served at once. MaxInFlight of 0
+// disables the limit. With TargetLatency the limit adapts between MinInFlight and
+// MaxInFlight to keep the average latency below it.
+type ConcurrencyLimitConfig struct {
+	MaxInFlight   int           `yaml:"max_in_flight"`
+	MinInFlight   int           `yaml:"min_in_flight"`
+	MaxQueue      int           `yaml:"max_queue"`
+	QueueTimeout  time.Duration `yaml:"queue_timeout"`
+	TargetLatency time.Duration `yaml:"target_latency"`
+}
+
+type ConcurrencyLimiter struct {
+	mutex    sync.Mutex
+	config   ConcurrencyLimitConfig
+	limit    int
+	inFlight int
+	waiters  *list.List
+	shed     int64
+
+	// admitted counts the latency of the admitted requests only, see Observe. The shed
+	// requests answer at once and would drag the average down under overload.
+	admitted Counter
+}
+
+var gobalConcurrencyLimiter *ConcurrencyLimiter
+
+func NewConcurrencyLimiter(config ConcurrencyLimitConfig) *ConcurrencyLimiter {
+	if config.MinInFlight <= 0 || config.MinInFlight > config.MaxInFlight {
+		config.MinInFlight = 1
+	}
+
+	return &ConcurrencyLimiter{config: config, limit: config.MaxInFlight, waiters: list.New()}
+}
+
+func initConcurrencyLimiter() {
+	if gobalConfig.ConcurrencyLimit.MaxInFlight <= 0 {
+		return
+	}
+
+	gobalConcurrencyLimiter = NewConcurrencyLimiter(gobalConfig.ConcurrencyLimit)
+	if gobalConfig.ConcurrencyLimit.TargetLatency > 0 {
+		gobalConcurrencyLimiter.Adapt(ConcurrencyAdaptInterval)
+	}
+}
+
+// Acquire takes a slot, waiting in the queue up to QueueTimeout. It returns false when the
+// queue is full, or the wait times out or outlives ctx.
+func (p *ConcurrencyLimiter) Acquire(ctx context.Context) bool {
+	p.mutex.Lock()
+	if p.inFlight < p.limit {
+		p.inFlight++
+		p.mutex.Unlock()
+		return true
+	}
+
+	if p.waiters.Len() >= p.config.MaxQueue || p.config.QueueTimeout <= 0 {
+		p.mutex.Unlock()
+		atomic.AddInt64(&p.shed, 1)
+		return false
+	}
+
+	ready := make(chan struct{})
+	element := p.waiters.PushBack(ready)
+	p.mutex.Unlock()
+
+	timer := time.NewTimer(p.config.QueueTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-ready:
+		return true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	select {
+	case <-ready:
+		// Release handed over a slot just before the timeout.
+		return true
+	default:
+		p.waiters.Remove(element)
+		atomic.AddInt64(&p.shed, 1)
+		return false
+	}
+}
+
+// Release frees a slot, handing it over to the first waiter if the limit allows.
+func (p *ConcurrencyLimiter) Release() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.waiters.Len() != 0 && p.inFlight <= p.limit {
+		close(p.waiters.Remove(p.waiters.Front()).(chan struct{}))
+		return
+	}
+
+	p.inFlight--
+}
+
+// Observe records the latency of an admitted request, from Acquire to Release.
+func (p *ConcurrencyLimiter) Observe(latency time.Duration) {
+	p.admitted.AddRequest(1)
+	p.admitted.AddLatency(latency.Nanoseconds())
+}
+
+// adjust moves the limit according to the average latency of the last interval.
+func (p *ConcurrencyLimiter) adjust(latency time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	old := p.limit
+	if latency > p.config.TargetLatency {
+		p.limit = int(float64(p.limit) * ConcurrencyDecreaseRatio)
+		if p.limit < p.config.MinInFlight {
+			p.limit = p.config.MinInFlight
+		}
+	} else if float64(p.inFlight) >= float64(p.limit)*ConcurrencyBusyRatio && p.limit < p.config.MaxInFlight {
+		p.limit++
+	}
+
+	if p.limit != old {
+		log.Debugf("[ConcurrencyLimiter.adjust] limit %v -> %v. latency=%v", old, p.limit, latency)
+	}
+}
+
+// Adapt adjusts the limit every interval with the average latency of the requests admitted
+// in that interval.
+func (p *ConcurrencyLimiter) Adapt(interval time.Duration) {
+	c := &p.admitted
+	go func() {
+		lastRequest, lastLatency := c.Request(), c.Latency()
+		for range time.Tick(interval) {
+			request, latency := c.Request(), c.Latency()
+			requests, latencies := request-lastRequest, latency-lastLatency
+			lastRequest, lastLatency = request, latency
+
+			// no traffic, or the counter was cleaned.
+			if requests <= 0 || latencies < 0 {
+				continue
+			}
+
+			p.adjust(time.Duration(latencies / requests))
+		}
+	}()
+}
+
+type ConcurrencyStats struct {
+	Limit    int
+	InFlight int
+	Queued   int
+	Shed     int64
+}
+
+func (p *ConcurrencyLimiter) Stats() ConcurrencyStats {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return ConcurrencyStats{p.limit, p.inFlight, p.waiters.Len(), atomic.LoadInt64(&p.shed)}
+}
+
+// concurrencyLimiting rejects the request with ERROR_SERVER_BUSY when the limiter is
+// saturated. It does nothing if limiter is nil.
+func concurrencyLimiting(limiter *ConcurrencyLimiter) Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		if limiter == nil {
+			return fn
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !limiter.Acquire(r.Context()) {
+				w.Header().Set("Retry-After", "1")
+				writeError(w, r, NewError(ERROR_SERVER_BUSY, "[concurrencyLimiting] server busy. path=%v", r.URL.Path))
+				return
+			}
+			defer func(start time.Time) {
+				limiter.Observe(time.Since(start))
+				limiter.Release()
+			}(time.Now())
+
+			fn(w, r)
+		}
+	}
+}
+
+func validateConcurrencyLimit(limit ConcurrencyLimitConfig) []string {
+	var problems []string
+	if limit.MaxInFlight < 0 || limit.MinInFlight < 0 || limit.MaxQueue < 0 {
+		problems = append(problems, "concurrency_limit: max_in_flight, min_in_flight and max_queue must not be negative")
+	}
+	if limit.MinInFlight > limit.MaxInFlight {
+		problems = append(problems, fmt.Sprintf("concurrency_limit: min_in_flight %v is above max_in_flight %v", limit.MinInFlight, limit.MaxInFlight))
+	}
+	if limit.QueueTimeout < 0 || limit.TargetLatency < 0 {
+		problems = append(problems, "concurrency_limit: queue_timeout and target_latency must not be negative")
+	}
+
+	return problems
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Suite(&LimiterSuite{})
+
+type LimiterSuite struct{}
+
+func (p *LimiterSuite) Test_Acquire_rejectWhenQueueFull(c *C) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimitConfig{MaxInFlight: 1})
+
+	c.Assert(limiter.Acquire(context.Background()), Equals, true)
+	c.Assert(limiter.Acquire(context.Background()), Equals, false)
+	c.Assert(limiter.Stats().Shed, Equals, int64(1))
+
+	limiter.Release()
+	c.Assert(limiter.Acquire(context.Background()), Equals, true)
+}
+
+func (p *LimiterSuite) Test_Acquire_waitInQueue(c *C) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimitConfig{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: time.Second})
+	c.Assert(limiter.Acquire(context.Background()), Equals, true)
+
+	acquired := make(chan bool)
+	go func() {
+		acquired <- limiter.Acquire(context.Background())
+	}()
+
+	for limiter.Stats().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	limiter.Release()
+
+	c.Assert(<-acquired, Equals, true)
+	c.Assert(limiter.Stats().InFlight, Equals, 1)
+}
+
+func (p *LimiterSuite) Test_Acquire_queueTimeout(c *C) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimitConfig{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: 10 * time.Millisecond})
+	c.Assert(limiter.Acquire(context.Background()), Equals, true)
+
+	c.Assert(limiter.Acquire(context.Background()), Equals, false)
+	c.Assert(limiter.Stats().Queued, Equals, 0)
+}
+
+func (p *LimiterSuite) Test_Acquire_contextDone(c *C) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimitConfig{MaxInFlight: 1, MaxQueue: 1, QueueTimeout: time.Minute})
+	c.Assert(limiter.Acquire(context.Background()), Equals, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	c.Assert(limiter.Acquire(ctx), Equals, false)
+	c.Assert(limiter.Stats().Queued, Equals, 0)
+}
+
+func (p *LimiterSuite) Test_adjust(c *C) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimitConfig{MaxInFlight: 10, MinInFlight: 8, TargetLatency: time.Millisecond})
+
+	limiter.adjust(2 * time.Millisecond)
+	c.Assert(limiter.Stats().Limit, Equals, 9)
+	limiter.adjust(2 * time.Millisecond)
+	c.Assert(limiter.Stats().Limit, Equals, 8)
+
+	for i := 0; i < 8; i++ {
+		limiter.Acquire(context.Background())
+	}
+	limiter.adjust(time.Microsecond)
+	c.Assert(limiter.Stats().Limit, Equals, 9)
+}
+
+func (p *LimiterSuite) Test_concurrencyLimiting_observesAdmittedOnly(c *C) {
+	limiter := NewConcurrencyLimiter(ConcurrencyLimitConfig{MaxInFlight: 1})
+	release := make(chan struct{})
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}, concurrencyLimiting(limiter))
+
+	done := make(chan struct{})
+	go func() {
+		handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/v2/info", nil))
+		close(done)
+	}()
+	for limiter.Stats().InFlight != 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/v2/info", nil))
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(limiter.admitted.Request(), Equals, int64(0))
+
+	time.Sleep(5 * time.Millisecond)
+	close(release)
+	<-done
+	c.Assert(limiter.admitted.Request(), Equals, int64(1))
+	c.Assert(limiter.admitted.Latency() >= int64(5*time.Millisecond), Equals, true)
+}
@@ -1,13 +1,438 @@
 package main
 
+import (
+	"flag"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
 const (
 	DefaultPort = 8080
+
+	DefaultDbName        = "follower"
+	DefaultCollName      = "user"
+	DefaultPushBatchSize = 2
+	DefaultUserIdLen     = 9
+
+	DefaultCertFile = "server.crt"
+	DefaultKeyFile  = "server.key"
+
+	DefaultTLSMinVersion      = "1.2"
+	DefaultCertReloadInterval = time.Minute
+
+	DefaultAdminAddr = "127.0.0.1:8081"
+
+	DefaultLogPath       = "log"
+	DefaultLogLevel      = "info"
+	DefaultLogFormat     = "text"
+	DefaultLogMaxSize    = 100
+	DefaultLogMaxAge     = 7
+	DefaultLogMaxBackups = 10
+
+	DefaultAccessLog       = "access.log"
+	DefaultAccessLogFormat = AccessLogFormatCombined
+
+	DefaultTraceExporter    = TraceExporterNone
+	DefaultTraceEndpoint    = "localhost:4318"
+	DefaultTraceSampleRatio = 1.0
+
+	DefaultShutdownTimeout = 30 * time.Second
+	DefaultShutdownDelay   = 5 * time.Second
+
+	DefaultReadHeaderTimeout = 5 * time.Second
+	DefaultReadTimeout       = 10 * time.Second
+	DefaultWriteTimeout      = 15 * time.Second
+	DefaultIdleTimeout       = 60 * time.Second
+	DefaultRequestTimeout    = 10 * time.Second
+
+	DefaultUserCacheSize = 10000
+
+	// EnvPrefix is prepended to the upper-cased config key to form its environment variable,
+	// e.g. FOLLOWER_MONGO_URI for mongo_uri.
+	EnvPrefix = "FOLLOWER_"
 )
 
+// Config is loaded, in increasing priority, from the flag defaults, the config file, the
+// FOLLOWER_* environment variables and the flags given on the command line. The yaml tag
+// of each field is its key in all of these.
 type Config struct {
-	IP       string
-	Port     int
-	MongoUri string
+	IP       string `yaml:"bind_ip"`
+	Port     int    `yaml:"port"`
+	MongoUri string `yaml:"mongo_uri"`
+
+	DbName        string `yaml:"db_name"`
+	CollName      string `yaml:"coll_name"`
+	PushBatchSize int    `yaml:"push_batch_size"`
+	UserIdLen     int    `yaml:"userid_len"`
+
+	// CoinsPerFollower is the price of the default app, see AppConfig.
+	CoinsPerFollower int64       `yaml:"coins_per_follower"`
+	Apps             []AppConfig `yaml:"apps"`
+
+	TLS                bool          `yaml:"tls"`
+	CertFile           string        `yaml:"cert_file"`
+	KeyFile            string        `yaml:"key_file"`
+	CertReloadInterval time.Duration `yaml:"cert_reload_interval"`
+	TLSMinVersion      string        `yaml:"tls_min_version"`
+	TLSCipherSuites    []string      `yaml:"tls_cipher_suites"`
+	ClientCAFile       string        `yaml:"client_ca_file"`
+
+	AdminAddr string `yaml:"admin_addr"`
+
+	// RateLimit applies to every client operation not in RouteRateLimits, which is keyed by
+	// the path or the operation of a route, e.g. /getfollowers/getuser or getuser.
+	RateLimit       RateLimitConfig            `yaml:"rate_limit"`
+	RouteRateLimits map[string]RateLimitConfig `yaml:"route_rate_limits"`
+
+	ConcurrencyLimit ConcurrencyLimitConfig `yaml:"concurrency_limit"`
+
+	// TrustedProxies are the CIDRs or IPs whose X-Forwarded-For and X-Forwarded-Proto are
+	// believed.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	LogPath           string        `yaml:"log_path"`
+	LogLevel          string        `yaml:"log_level"`
+	LogFormat         string        `yaml:"log_format"`
+	LogMaxSize        int           `yaml:"log_max_size"`
+	LogMaxAge         int           `yaml:"log_max_age"`
+	LogMaxBackups     int           `yaml:"log_max_backups"`
+	LogRotateInterval time.Duration `yaml:"log_rotate_interval"`
+
+	AccessLog           string `yaml:"access_log"`
+	AccessLogFormat     string `yaml:"access_log_format"`
+	AccessLogHashUserId bool   `yaml:"access_log_hash_userid"`
+
+	TraceExporter    string  `yaml:"trace_exporter"`
+	TraceEndpoint    string  `yaml:"trace_endpoint"`
+	TraceInsecure    bool    `yaml:"trace_insecure"`
+	TraceSampleRatio float64 `yaml:"trace_sample_ratio"`
+
+	// ShutdownDelay is how long the server keeps serving once draining, before it stops
+	// accepting connections. ShutdownTimeout bounds the drain of the http requests, and
+	// that of the grpc calls.
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
+
+	// The timeouts of the client listener, see http.Server. 0 disables a timeout.
+	// RequestTimeout is the deadline of every client request, including its mongodb
+	// operations and the wait for the PushManager, and should stay below WriteTimeout.
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"`
+	ReadTimeout       time.Duration `yaml:"read_timeout"`
+	WriteTimeout      time.Duration `yaml:"write_timeout"`
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`
+	RequestTimeout    time.Duration `yaml:"request_timeout"`
+
+	DbRetry   RetryConfig   `yaml:"db_retry"`
+	DbBreaker BreakerConfig `yaml:"db_breaker"`
+
+	// UserCacheSize bounds the cached info and progress results served while mongodb is
+	// unavailable. 0 disables the cache. With the cache, readyzHandler stays ready while
+	// mongodb is down.
+	UserCacheSize int `yaml:"user_cache_size"`
+
+	// IdempotencyTTL is how long the responses of the write routes are replayed to requests
+	// repeating their Idempotency-Key. 0 disables.
+	IdempotencyTTL time.Duration `yaml:"idempotency_ttl"`
+
+	// IdempotencyMaxKeys bounds the Idempotency-Key responses kept, dropping the least
+	// recently used.
+	IdempotencyMaxKeys int `yaml:"idempotency_max_keys"`
+
+	// GrpcAddr serves the grpc service, see FollowerServer. Empty disables it.
+	GrpcAddr string `yaml:"grpc_addr"`
+
+	// GrpcMaxWatches bounds the WatchProgress streams running at once. 0 is no limit.
+	GrpcMaxWatches int `yaml:"grpc_max_watches"`
+
+	// ValidateResponses checks every client response against the openapi document and logs
+	// those which differ. It costs a copy of each response and is meant for debugging.
+	ValidateResponses bool `yaml:"validate_responses"`
+
+	// Versions are the accepted values of the version parameter of the v1 routes, and
+	// MinVersion rejects the older ones with ERROR_UPGRADE_REQUIRED.
+	Versions   []VersionConfig `yaml:"versions"`
+	MinVersion int64           `yaml:"min_version"`
 }
 
+// the defaults of the settings which can only be set in the config file.
+var (
+	DefaultDbRetry   = RetryConfig{MaxAttempts: 3, BaseDelay: 20 * time.Millisecond, MaxDelay: 200 * time.Millisecond}
+	DefaultDbBreaker = BreakerConfig{FailureThreshold: 5, OpenTimeout: 10 * time.Second}
+	DefaultVersions  = []VersionConfig{{Version: 1}}
+)
+
 var gobalConfig = Config{}
+
+// gobalConfigMutex guards the fields which reloadConfig may change at runtime. Read them
+// through currentConfig.
+var gobalConfigMutex sync.RWMutex
+
+var gobalConfigFile string
+
+// flagAliases maps legacy flag names to their config key.
+var flagAliases = map[string]string{
+	"mongoUri": "mongo_uri",
+}
+
+func currentConfig() Config {
+	gobalConfigMutex.RLock()
+	defer gobalConfigMutex.RUnlock()
+
+	return gobalConfig
+}
+
+// loadConfig builds the config from the flag defaults, the config file, the environment
+// and the explicitly set flags, and validates it.
+func loadConfig(flags *flag.FlagSet, configFile string) (Config, error) {
+	var cfg Config
+
+	var err error
+	flags.VisitAll(func(f *flag.Flag) {
+		if err == nil {
+			err = setConfigField(&cfg, flagKey(f.Name), f.DefValue)
+		}
+	})
+	if err != nil {
+		return cfg, err
+	}
+	cfg.DbRetry = DefaultDbRetry
+	cfg.DbBreaker = DefaultDbBreaker
+	cfg.Versions = DefaultVersions
+
+	if configFile != "" {
+		content, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return cfg, fmt.Errorf("read config file %v failed: %v", configFile, err)
+		}
+
+		if err = yaml.UnmarshalStrict(content, &cfg); err != nil {
+			return cfg, fmt.Errorf("parse config file %v failed: %v", configFile, err)
+		}
+	}
+
+	if err = applyEnv(&cfg, os.LookupEnv); err != nil {
+		return cfg, err
+	}
+
+	flags.Visit(func(f *flag.Flag) {
+		if err == nil {
+			err = setConfigField(&cfg, flagKey(f.Name), f.Value.String())
+		}
+	})
+	if err != nil {
+		return cfg, err
+	}
+
+	return cfg, validateConfig(cfg)
+}
+
+func flagKey(name string) string {
+	if key, ok := flagAliases[name]; ok {
+		return key
+	}
+
+	return name
+}
+
+func applyEnv(cfg *Config, lookupEnv func(string) (string, bool)) error {
+	t := reflect.TypeOf(*cfg)
+	for i := 0; i < t.NumField(); i++ {
+		key := yamlKey(t.Field(i))
+		if key == "" {
+			continue
+		}
+
+		if value, ok := lookupEnv(EnvPrefix + strings.ToUpper(key)); ok {
+			if err := setConfigField(cfg, key, value); err != nil {
+				return fmt.Errorf("environment %v%v: %v", EnvPrefix, strings.ToUpper(key), err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func yamlKey(field reflect.StructField) string {
+	key := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if key == "-" {
+		return ""
+	}
+
+	return key
+}
+
+// setConfigField parses value into the field whose yaml key is key. Keys not in Config,
+// such as "config" itself, are ignored.
+func setConfigField(cfg *Config, key string, value string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if yamlKey(t.Field(i)) != key {
+			continue
+		}
+
+		field := v.Field(i)
+		switch {
+		case field.Type() == reflect.TypeOf(time.Duration(0)):
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("%v: invalid duration %q", key, value)
+			}
+			field.SetInt(int64(d))
+		case field.Kind() == reflect.String:
+			field.SetString(value)
+		case field.Kind() == reflect.Int || field.Kind() == reflect.Int64:
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("%v: invalid integer %q", key, value)
+			}
+			field.SetInt(int64(n))
+		case field.Kind() == reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("%v: invalid boolean %q", key, value)
+			}
+			field.SetBool(b)
+		case field.Kind() == reflect.Float64:
+			f, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return fmt.Errorf("%v: invalid number %q", key, value)
+			}
+			field.SetFloat(f)
+		case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+		default:
+			return fmt.Errorf("%v: can only be set in the config file", key)
+		}
+
+		return nil
+	}
+
+	return nil
+}
+
+// validateConfig reports every invalid setting at once.
+func validateConfig(cfg Config) error {
+	var problems []string
+	check := func(ok bool, format string, a ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, a...))
+		}
+	}
+
+	check(cfg.MongoUri != "", "mongo_uri is required")
+	check(cfg.Port > 0 && cfg.Port < 65536, "port must be between 1 and 65535, got %v", cfg.Port)
+	check(cfg.DbName != "", "db_name is required")
+	check(cfg.CollName != "", "coll_name is required")
+	check(cfg.PushBatchSize > 0, "push_batch_size must be positive, got %v", cfg.PushBatchSize)
+	check(cfg.UserIdLen > 0, "userid_len must be positive, got %v", cfg.UserIdLen)
+	check(cfg.CoinsPerFollower >= 0, "coins_per_follower must not be negative, got %v", cfg.CoinsPerFollower)
+	problems = append(problems, validateApps(cfg)...)
+	problems = append(problems, validateTLS(cfg)...)
+	check(cfg.AdminAddr != "", "admin_addr is required")
+	problems = append(problems, validateRateLimit("rate_limit", cfg.RateLimit)...)
+	problems = append(problems, validateRouteRateLimits(cfg.RouteRateLimits)...)
+	problems = append(problems, validateConcurrencyLimit(cfg.ConcurrencyLimit)...)
+	problems = append(problems, validateRetry(cfg.DbRetry)...)
+	problems = append(problems, validateBreaker(cfg.DbBreaker)...)
+	problems = append(problems, validateVersions(cfg.Versions, cfg.MinVersion)...)
+	if _, err := parseTrustedProxies(cfg.TrustedProxies); err != nil {
+		problems = append(problems, fmt.Sprintf("trusted_proxies: %v", err))
+	}
+
+	_, err := log.ParseLevel(cfg.LogLevel)
+	check(err == nil, "log_level must be one of debug, info, warn, error, got %q", cfg.LogLevel)
+	check(cfg.LogFormat == "text" || cfg.LogFormat == "json", "log_format must be text or json, got %q", cfg.LogFormat)
+	check(cfg.LogMaxSize > 0, "log_max_size must be positive, got %v", cfg.LogMaxSize)
+	check(cfg.LogMaxAge >= 0, "log_max_age must not be negative, got %v", cfg.LogMaxAge)
+	check(cfg.LogMaxBackups >= 0, "log_max_backups must not be negative, got %v", cfg.LogMaxBackups)
+	check(cfg.LogRotateInterval >= 0, "log_rotate_interval must not be negative, got %v", cfg.LogRotateInterval)
+	check(cfg.AccessLogFormat == AccessLogFormatCombined || cfg.AccessLogFormat == AccessLogFormatJson,
+		"access_log_format must be combined or json, got %q", cfg.AccessLogFormat)
+	check(cfg.TraceExporter == TraceExporterNone || cfg.TraceExporter == TraceExporterStdout || cfg.TraceExporter == TraceExporterOtlp,
+		"trace_exporter must be none, stdout or otlp, got %q", cfg.TraceExporter)
+	check(cfg.TraceSampleRatio >= 0 && cfg.TraceSampleRatio <= 1, "trace_sample_ratio must be between 0 and 1, got %v", cfg.TraceSampleRatio)
+	check(cfg.ShutdownDelay >= 0, "shutdown_delay must not be negative, got %v", cfg.ShutdownDelay)
+	check(cfg.ShutdownTimeout > 0, "shutdown_timeout must be positive, got %v", cfg.ShutdownTimeout)
+	check(cfg.ReadHeaderTimeout >= 0 && cfg.ReadTimeout >= 0 && cfg.WriteTimeout >= 0 && cfg.IdleTimeout >= 0,
+		"read_header_timeout, read_timeout, write_timeout and idle_timeout must not be negative")
+	check(cfg.IdempotencyTTL >= 0, "idempotency_ttl must not be negative, got %v", cfg.IdempotencyTTL)
+	check(cfg.IdempotencyTTL == 0 || cfg.IdempotencyMaxKeys > 0, "idempotency_max_keys must be positive, got %v", cfg.IdempotencyMaxKeys)
+	check(cfg.GrpcMaxWatches >= 0, "grpc_max_watches must not be negative, got %v", cfg.GrpcMaxWatches)
+	check(cfg.UserCacheSize >= 0, "user_cache_size must not be negative, got %v", cfg.UserCacheSize)
+	check(cfg.RequestTimeout > 0, "request_timeout must be positive, got %v", cfg.RequestTimeout)
+	check(cfg.WriteTimeout == 0 || cfg.RequestTimeout < cfg.WriteTimeout,
+		"request_timeout %v must be below write_timeout %v, or the timeout error cannot be written", cfg.RequestTimeout, cfg.WriteTimeout)
+
+	if len(problems) != 0 {
+		return fmt.Errorf("invalid config:\n  %v", strings.Join(problems, "\n  "))
+	}
+
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// reloadConfig re-reads the config on SIGHUP and applies the settings which are safe to
+// change at runtime: log_level, log_format, push_batch_size, userid_len, cert_file,
+// key_file, versions and min_version. The others need a restart and are reported if they differ.
+// It returns the error of an invalid config, which leaves the current one in place.
+func reloadConfig() error {
+	cfg, err := loadConfig(flag.CommandLine, gobalConfigFile)
+	if err != nil {
+		log.Errorf("[reloadConfig] keep the current config. error=%v", err)
+		return err
+	}
+
+	gobalConfigMutex.Lock()
+	old := gobalConfig
+	gobalConfig.LogLevel = cfg.LogLevel
+	gobalConfig.LogFormat = cfg.LogFormat
+	gobalConfig.PushBatchSize = cfg.PushBatchSize
+	gobalConfig.UserIdLen = cfg.UserIdLen
+	gobalConfig.CertFile = cfg.CertFile
+	gobalConfig.KeyFile = cfg.KeyFile
+	gobalConfig.Versions = cfg.Versions
+	gobalConfig.MinVersion = cfg.MinVersion
+	current := gobalConfig
+	gobalConfigMutex.Unlock()
+
+	setLogLevelAndFormat(cfg.LogLevel, cfg.LogFormat)
+
+	if gobalCertReloader != nil {
+		if err := gobalCertReloader.Reload(); err != nil {
+			log.Errorf("[reloadConfig] keep the current certificate. %v", err)
+		}
+	}
+
+	if !reflect.DeepEqual(current, cfg) {
+		log.Warnf("[reloadConfig] some changed settings need a restart to take effect.")
+	}
+
+	log.WithFields(log.Fields{
+		"logLevel":      fmt.Sprintf("%v -> %v", old.LogLevel, current.LogLevel),
+		"logFormat":     fmt.Sprintf("%v -> %v", old.LogFormat, current.LogFormat),
+		"pushBatchSize": fmt.Sprintf("%v -> %v", old.PushBatchSize, current.PushBatchSize),
+		"useridLen":     fmt.Sprintf("%v -> %v", old.UserIdLen, current.UserIdLen),
+		"minVersion":    fmt.Sprintf("%v -> %v", old.MinVersion, current.MinVersion),
+	}).Info("config reloaded")
+
+	return nil
+}
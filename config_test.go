@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var _ = Suite(&ConfigSuite{})
+
+type ConfigSuite struct {
+	dir string
+}
+
+func (p *ConfigSuite) SetUpTest(c *C) {
+	p.dir = c.MkDir()
+	for _, name := range []string{"server.crt", "server.key"} {
+		err := ioutil.WriteFile(filepath.Join(p.dir, name), []byte{}, 0600)
+		c.Assert(err, IsNil)
+	}
+}
+
+func (p *ConfigSuite) newFlagSet(args ...string) *flag.FlagSet {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	defineFlags(flags)
+	args = append(args, "-cert_file", filepath.Join(p.dir, "server.crt"), "-key_file", filepath.Join(p.dir, "server.key"))
+	flags.Parse(args)
+	return flags
+}
+
+func (p *ConfigSuite) writeConfigFile(c *C, content string) string {
+	name := filepath.Join(p.dir, "config.yaml")
+	c.Assert(ioutil.WriteFile(name, []byte(content), 0600), IsNil)
+	return name
+}
+
+func (p *ConfigSuite) Test_loadConfig_priority(c *C) {
+	file := p.writeConfigFile(c, "mongo_uri: mongodb://file\nport: 9000\ndb_name: filedb\nshutdown_timeout: 5s\n")
+	os.Setenv("FOLLOWER_DB_NAME", "envdb")
+	os.Setenv("FOLLOWER_PORT", "9001")
+	defer os.Unsetenv("FOLLOWER_DB_NAME")
+	defer os.Unsetenv("FOLLOWER_PORT")
+
+	cfg, err := loadConfig(p.newFlagSet("-port", "9002"), file)
+	c.Assert(err, IsNil)
+
+	c.Assert(cfg.MongoUri, Equals, "mongodb://file")
+	c.Assert(cfg.DbName, Equals, "envdb")
+	c.Assert(cfg.Port, Equals, 9002)
+	c.Assert(cfg.ShutdownTimeout, Equals, 5*time.Second)
+	c.Assert(cfg.CollName, Equals, DefaultCollName)
+}
+
+func (p *ConfigSuite) Test_loadConfig_fileOnlyDefaults(c *C) {
+	file := p.writeConfigFile(c, "mongo_uri: mongodb://file\ndb_retry:\n  max_attempts: 5\n")
+
+	cfg, err := loadConfig(p.newFlagSet(), file)
+	c.Assert(err, IsNil)
+
+	c.Assert(cfg.DbRetry.MaxAttempts, Equals, 5)
+	c.Assert(cfg.DbRetry.MaxDelay, Equals, DefaultDbRetry.MaxDelay)
+	c.Assert(cfg.DbBreaker, Equals, DefaultDbBreaker)
+	c.Assert(cfg.Versions, DeepEquals, DefaultVersions)
+}
+
+func (p *ConfigSuite) Test_loadConfig_versions(c *C) {
+	file := p.writeConfigFile(c, "mongo_uri: mongodb://file\nversions:\n  - version: 1\n    sunset: 2026-07-01T00:00:00Z\n  - version: 2\nmin_version: 1\n")
+
+	cfg, err := loadConfig(p.newFlagSet(), file)
+	c.Assert(err, IsNil)
+
+	c.Assert(len(cfg.Versions), Equals, 2)
+	c.Assert(cfg.Versions[0].Sunset.Equal(time.Date(2026, 7, 1, 0, 0, 0, 0, time.UTC)), Equals, true)
+	c.Assert(cfg.MinVersion, Equals, int64(1))
+}
+
+func (p *ConfigSuite) Test_loadConfig_legacyFlag(c *C) {
+	cfg, err := loadConfig(p.newFlagSet("-mongoUri", "mongodb://legacy"), "")
+	c.Assert(err, IsNil)
+	c.Assert(cfg.MongoUri, Equals, "mongodb://legacy")
+}
+
+func (p *ConfigSuite) Test_loadConfig_unknownKey(c *C) {
+	file := p.writeConfigFile(c, "mongo_uri: mongodb://file\nmongo_url: typo\n")
+
+	_, err := loadConfig(p.newFlagSet(), file)
+	c.Assert(err, ErrorMatches, "(?s)parse config file.*mongo_url.*")
+}
+
+func (p *ConfigSuite) Test_loadConfig_reportAllProblems(c *C) {
+	file := p.writeConfigFile(c, "push_batch_size: 0\nlog_level: verbose\ntrace_sample_ratio: 2\n")
+
+	_, err := loadConfig(p.newFlagSet(), file)
+	c.Assert(err, NotNil)
+	for _, key := range []string{"mongo_uri", "push_batch_size", "log_level", "trace_sample_ratio"} {
+		c.Assert(strings.Contains(err.Error(), key), Equals, true, Commentf("%v not reported", key))
+	}
+}
+
+func (p *ConfigSuite) Test_applyEnv_invalidValue(c *C) {
+	cfg := Config{}
+	err := applyEnv(&cfg, func(key string) (string, bool) {
+		if key == "FOLLOWER_PORT" {
+			return "http", true
+		}
+		return "", false
+	})
+	c.Assert(err, ErrorMatches, "environment FOLLOWER_PORT: port: invalid integer .*")
+}
@@ -64,19 +64,21 @@ func (p *Counter) Clean() {
 	atomic.SwapInt64(&p.requestPerSecond, 0)
 }
 
-func counterHander(w http.ResponseWriter, r *http.Request) {
+func counterHander(w http.ResponseWriter, r *http.Request) error {
 	result := map[string]interface{}{
 		"request":          gobalCounter.Request(),
 		"latency":          gobalCounter.Latency(),
 		"aveLatency":       gobalCounter.AveLatency(),
 		"requestPerSecond": gobalCounter.RequestPerSecond(),
+		"dbBreaker":        gobalDbBreaker.State().String(),
+		"dbRetries":        atomic.LoadInt64(&gobalDbRetries),
 	}
 
 	bResult, err := json.Marshal(result)
 	if err != nil {
-		err := NewError(ERROR_INTERNAL, "[counterHander] json.Marshal failed. error=%v", err)
-		checkError(err)
+		return NewError(ERROR_INTERNAL, "[counterHander] json.Marshal failed. error=%v", err)
 	}
 
 	io.WriteString(w, string(bResult))
+	return nil
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"gopkg.in/mgo.v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// withTimeout sets the deadline of the request context. Mongodb operations and the wait for
+// the PushManager give up with ERROR_TIMEOUT once it passes.
+func withTimeout(timeout time.Duration) Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		if timeout <= 0 {
+			return fn
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+
+			fn(w, r.WithContext(ctx))
+		}
+	}
+}
+
+// newDbSession copies the mongodb session with its socket and sync timeouts bounded by the
+// deadline of ctx. It fails fast with ERROR_DB_UNAVAILABLE while the circuit breaker is
+// open. Close it when done.
+func newDbSession(ctx context.Context) (*mgo.Session, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, NewError(ERROR_TIMEOUT, "[newDbSession] request deadline exceeded. error=%v", err)
+	}
+	if !gobalDbBreaker.Allow() {
+		return nil, NewError(ERROR_DB_UNAVAILABLE, "[newDbSession] mongodb circuit breaker is open.")
+	}
+
+	session := gobalMgoSession.Copy()
+	setDbTimeouts(ctx, session)
+
+	return session, nil
+}
+
+// setDbTimeouts bounds the socket and sync timeouts of session by the time left until the
+// deadline of ctx. mgo takes a timeout of 0 as none, so at least a millisecond is left.
+func setDbTimeouts(ctx context.Context, session *mgo.Session) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return
+	}
+
+	remaining := time.Until(deadline)
+	if remaining < time.Millisecond {
+		remaining = time.Millisecond
+	}
+	session.SetSocketTimeout(remaining)
+	session.SetSyncTimeout(remaining)
+}
+
+// dbError builds the error of a failed mongodb operation: ERROR_TIMEOUT if the deadline of
+// ctx cut it short, or else code.
+func dbError(ctx context.Context, err error, code int, format string, a ...interface{}) error {
+	if ctx.Err() != nil {
+		code = ERROR_TIMEOUT
+	} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
+		code = ERROR_TIMEOUT
+	}
+
+	return NewError(code, format, a...)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"errors"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Suite(&DeadlineSuite{})
+
+type DeadlineSuite struct{}
+
+func (p *DeadlineSuite) Test_withTimeout(c *C) {
+	var deadline time.Time
+	var ok bool
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {
+		deadline, ok = r.Context().Deadline()
+	}, withTimeout(time.Second))
+
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/getfollowers/info", nil))
+
+	c.Assert(ok, Equals, true)
+	c.Assert(time.Until(deadline) <= time.Second, Equals, true)
+}
+
+func (p *DeadlineSuite) Test_PushManager_lockTimeout(c *C) {
+	manager := NewPushManager("follower", "user")
+	c.Assert(manager.lock(context.Background()), IsNil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := manager.lock(ctx)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_TIMEOUT)
+
+	manager.unlock()
+	c.Assert(manager.lock(context.Background()), IsNil)
+}
+
+func (p *DeadlineSuite) Test_dbDo_deadline(c *C) {
+	defer func(breaker *CircuitBreaker) { gobalDbBreaker = breaker }(gobalDbBreaker)
+	gobalDbBreaker = NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, time.Now)
+	failure := errors.New("i/o timeout")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Assert(dbDo(ctx, func() error { return failure }), Equals, failure)
+	c.Assert(gobalDbBreaker.State(), Equals, BreakerClosed)
+
+	c.Assert(dbDo(context.Background(), func() error { return failure }), Equals, failure)
+	c.Assert(gobalDbBreaker.State(), Equals, BreakerOpen)
+}
+
+func (p *DeadlineSuite) Test_dbError(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.Assert(dbError(ctx, nil, ERROR_DB_OPERATE_FAIELD, "failed").(FollowerError).Code, Equals, ERROR_DB_OPERATE_FAIELD)
+
+	cancel()
+	c.Assert(dbError(ctx, nil, ERROR_DB_OPERATE_FAIELD, "failed").(FollowerError).Code, Equals, ERROR_TIMEOUT)
+}
@@ -2,38 +2,76 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 )
 
 const (
-	ERROR_INTERNAL          = 0x10000001
-	ERROR_DB_OPERATE_FAIELD = 0x10000002
-	ERROR_URL_PARAM_INVALID = 0x10000003
-	ERROR_NO_BUYER          = 0x10000004
-	ERROR_USER_NOT_FOUND    = 0x10000005
+	ERROR_INTERNAL                = 0x10000001
+	ERROR_DB_OPERATE_FAIELD       = 0x10000002
+	ERROR_URL_PARAM_INVALID       = 0x10000003
+	ERROR_NO_BUYER                = 0x10000004
+	ERROR_USER_NOT_FOUND          = 0x10000005
+	ERROR_APP_NOT_FOUND           = 0x10000006
+	ERROR_CLIENT_CERT_REQUIRED    = 0x10000007
+	ERROR_RATE_LIMITED            = 0x10000008
+	ERROR_SERVER_BUSY             = 0x10000009
+	ERROR_TIMEOUT                 = 0x1000000A
+	ERROR_DB_UNAVAILABLE          = 0x1000000B
+	ERROR_READ_ONLY               = 0x1000000C
+	ERROR_MAINTENANCE             = 0x1000000D
+	ERROR_ROUTE_NOT_FOUND         = 0x1000000E
+	ERROR_METHOD_NOT_ALLOWED      = 0x1000000F
+	ERROR_VERSION_UNSUPPORTED     = 0x10000010
+	ERROR_VERSION_RETIRED         = 0x10000011
+	ERROR_UPGRADE_REQUIRED        = 0x10000012
+	ERROR_IDEMPOTENCY_IN_PROGRESS = 0x10000013
+	ERROR_IDEMPOTENCY_KEY_REUSED  = 0x10000014
+	ERROR_IDEMPOTENCY_UNKNOWN     = 0x10000015
+	ERROR_UNSUPPORTED_MEDIA_TYPE  = 0x10000016
+	ERROR_INSUFFICIENT_COINS      = 0x10000017
 )
 
+// FollowerError carries a client safe message in Msg, and the internal Detail which only
+// goes to the logs.
 type FollowerError struct {
-	Code int    `json:"code"`
-	Msg  string `json:"errMsg"`
+	Code       int         `json:"code"`
+	Name       string      `json:"errName,omitempty"`
+	Msg        string      `json:"errMsg"`
+	Violations []Violation `json:"violations,omitempty"`
+	Detail     string      `json:"-"`
 }
 
 func (p FollowerError) Error() string {
+	if p.Detail != "" {
+		return p.Detail
+	}
+
 	return p.Msg
 }
 
-func checkError(err error) {
-	if err != nil {
-		panic(err)
+// httpStatus returns the http status code of the error code.
+func httpStatus(code int) int {
+	if entry, ok := errorCatalogByCode[code]; ok {
+		return entry.Status
 	}
+
+	return http.StatusBadRequest
 }
 
+// NewError builds an error with the default client message of code. The formatted
+// detail is only logged.
 func NewError(code int, format string, a ...interface{}) error {
+	return NewErrorMsg(code, errorCatalogByCode[code].Messages[DefaultLang], format, a...)
+}
+
+// NewErrorMsg builds an error with the client message msg.
+func NewErrorMsg(code int, msg string, format string, a ...interface{}) error {
 	var s string
 	if len(a) != 0 {
-		s = fmt.Sprintf(format, a)
+		s = fmt.Sprintf(format, a...)
 	} else {
 		s = format
 	}
 
-	return FollowerError{code, s}
+	return FollowerError{Code: code, Name: errorCatalogByCode[code].Name, Msg: msg, Detail: s}
 }
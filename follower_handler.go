@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/satori/go.uuid"
@@ -8,215 +9,343 @@ import (
 	"gopkg.in/mgo.v2/bson"
 	"io"
 	"net/http"
-	"net/url"
-	"strconv"
 	"time"
 )
 
-const USERID_LEN int = 9
+// UserRequest is the request of info, progress and getuser.
+type UserRequest struct {
+	UserId  string `param:"userId" validate:"required,userid"`
+	Version int    `param:"version" validate:"required,version"`
+}
 
-func progressHandler(w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
+type CoinsRequest struct {
+	UserId  string `param:"userId" validate:"required,userid"`
+	Version int    `param:"version" validate:"required,version"`
+	Coins   int64  `param:"coins" validate:"required"`
+}
 
-	err := validProgressUrlParam(r.Form)
-	checkError(err)
+type BuyFollowerRequest struct {
+	UserId  string `param:"userId" validate:"required,userid"`
+	Version int    `param:"version" validate:"required,version"`
+	Coins   int64  `param:"coins" validate:"required,min=1"`
+	Value   int64  `param:"value" validate:"required,min=1"`
+}
 
-	result, err := queryProgress(r.Form)
-	checkError(err)
+// The responses of the client api, returned by the service functions and documented by the
+// openapi document. Stale and CachedAt mark a cached result served while mongodb is
+// unavailable.
+type OrderProgress struct {
+	Fans     int64 `json:"fans" bson:"fans"`
+	Progress int64 `json:"progress" bson:"progress"`
+	Status   bool  `json:"status" bson:"status"`
+}
 
-	responseToClient(w, result)
+type ProgressResponse struct {
+	UserId   string          `json:"userId" bson:"userId"`
+	Orders   []OrderProgress `json:"orders,omitempty" bson:"orders"`
+	Stale    bool            `json:"stale,omitempty" bson:"stale"`
+	CachedAt int64           `json:"cachedAt,omitempty" bson:"cachedAt"`
 }
 
-func infoHandler(w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
+type InfoResponse struct {
+	UserId   string          `json:"userId" bson:"userId"`
+	Coins    int64           `json:"coins" bson:"coins"`
+	Orders   []OrderProgress `json:"orders,omitempty" bson:"orders"`
+	Stale    bool            `json:"stale,omitempty" bson:"stale"`
+	CachedAt int64           `json:"cachedAt,omitempty" bson:"cachedAt"`
+}
+
+type CoinsResponse struct {
+	UserId string `json:"userId" bson:"userId"`
+	Coins  int64  `json:"coins" bson:"coins"`
+}
+
+type BuyFollowerResponse struct {
+	Coins int64 `json:"coins" bson:"coins"`
+}
 
-	checkError(validInfoUrlParam(r.Form))
+// GetUserResponse lists the buyers to follow.
+type GetUserResponse struct {
+	UserIds []string `json:"userIDs"`
+}
 
-	userId := r.Form["userId"][0]
-	result, err := queryInfo(userId)
-	if err != nil && err.(FollowerError).Code == ERROR_USER_NOT_FOUND {
-		err = CreateNewUser(userId)
-		checkError(err)
+func progressHandler(w http.ResponseWriter, r *http.Request) error {
+	var req UserRequest
+	if err := parseRequest(r, &req); err != nil {
+		return err
+	}
 
-		result = bson.M{"userId": userId, "coins": 0}
+	result, err := getProgress(r.Context(), appFromContext(r.Context()), req.UserId)
+	if err != nil {
+		return err
 	}
 
-	checkError(err)
-	responseToClient(w, result)
+	return responseToClient(w, result)
 }
 
-func CreateNewUser(userId string) error {
-	doc := bson.M{
-		"userId":       userId,
-		"coins":        int64(0),
-		"lastPushDate": int64(0),
+func infoHandler(w http.ResponseWriter, r *http.Request) error {
+	var req UserRequest
+	if err := parseRequest(r, &req); err != nil {
+		return err
 	}
 
-	session := gobalMgoSession.Copy()
-	collection := session.DB("follower").C("user")
-	err := collection.Insert(doc)
+	result, err := getInfo(r.Context(), appFromContext(r.Context()), req.UserId)
 	if err != nil {
-		return NewError(ERROR_DB_OPERATE_FAIELD, "[CreateNewUser] collection.Insert failed. error=%v", err.Error())
+		return err
 	}
 
-	return nil
+	return responseToClient(w, result)
 }
 
-func getUserHandler(w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
-
-	checkError(validUserUrlParam(r.Form))
+func getUserHandler(w http.ResponseWriter, r *http.Request) error {
+	var req UserRequest
+	if err := parseRequest(r, &req); err != nil {
+		return err
+	}
 
-	userId := r.Form["userId"][0]
-	checkError(gobalPushManger.push(w, userId, 2))
+	return getUsers(r.Context(), appFromContext(r.Context()), req.UserId, respondUsers(w))
 }
 
-func validUserUrlParam(values url.Values) error {
-	if _, ok := values["userId"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validUserUrlParam] url no userId param")
+func buyfollowerHandler(w http.ResponseWriter, r *http.Request) error {
+	var req BuyFollowerRequest
+	if err := parseRequest(r, &req); err != nil {
+		return err
 	}
 
-	id := values["userId"][0]
-	if len(id) != USERID_LEN {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validBuyFollowerUrlParam] len(id) != USERID_LEN.")
+	result, err := buyFollowers(r.Context(), appFromContext(r.Context()), req.UserId, req.Coins, req.Value)
+	if err != nil {
+		return err
 	}
 
-	if _, ok := values["version"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validUserUrlParam] url no version param")
+	return responseToClient(w, result)
+}
+
+func coinsHandler(w http.ResponseWriter, r *http.Request) error {
+	var req CoinsRequest
+	if err := parseRequest(r, &req); err != nil {
+		return err
 	}
 
-	version := values["version"][0]
-	if !validVersion(version) {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validBuyFollowerUrlParam] version invalid. version=%v", version)
+	result, err := addCoins(r.Context(), appFromContext(r.Context()), req.UserId, req.Coins)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return responseToClient(w, result)
 }
 
-func buyfollowerHandler(w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
+// getProgress returns the orders of the user, from the cache while mongodb is unavailable.
+func getProgress(ctx context.Context, app *App, userId string) (ProgressResponse, error) {
+	var resp ProgressResponse
+	result, err := gobalUserCache.cachedQuery(userCacheKey(app, "progress", userId), func() (bson.M, error) {
+		return queryProgress(ctx, app, userId)
+	})
+	if err != nil {
+		return resp, err
+	}
 
-	checkError(validBuyFollowerUrlParam(r.Form))
+	return resp, fromBson(result, &resp)
+}
 
-	userId := r.Form["userId"][0]
-	coins := r.Form["coins"][0]
-	coinsInt, _ := strconv.Atoi(coins)
-	fans := r.Form["value"][0]
-	fansInt, _ := strconv.Atoi(fans)
+// getInfo returns the coins and orders of the user, creating the user if unknown.
+func getInfo(ctx context.Context, app *App, userId string) (InfoResponse, error) {
+	var resp InfoResponse
+	result, err := gobalUserCache.cachedQuery(userCacheKey(app, "info", userId), func() (bson.M, error) {
+		return queryInfo(ctx, app, userId)
+	})
+	if e, ok := err.(FollowerError); ok && e.Code == ERROR_USER_NOT_FOUND {
+		if err := checkWritable(); err != nil {
+			return resp, err
+		}
+		if err := CreateNewUser(ctx, app, userId); err != nil {
+			return resp, err
+		}
 
-	order := Order{
-		fmt.Sprintf("%v", uuid.NewV4()),
-		time.Now().Unix(),
-		int64(coinsInt),
-		int64(fansInt),
-		0, false,
+		return InfoResponse{UserId: userId}, nil
+	} else if err != nil {
+		return resp, err
 	}
 
-	session := gobalMgoSession.Copy()
-	collection := session.DB("follower").C("user")
+	return resp, fromBson(result, &resp)
+}
 
-	var result bson.M
-	queryStatement := bson.M{"userId": userId, "coins": bson.M{"$gte": coinsInt}}
-	query := collection.Find(queryStatement)
-	change := mgo.Change{Update: bson.M{"$inc": bson.M{"coins": -coinsInt}, "$addToSet": bson.M{"orders": order}}, ReturnNew: true}
-	_, err := query.Apply(change, &result)
+// fromBson decodes the mongodb result into the response struct pointed to by resp.
+func fromBson(result bson.M, resp interface{}) error {
+	data, err := bson.Marshal(result)
+	if err == nil {
+		err = bson.Unmarshal(data, resp)
+	}
 	if err != nil {
-		err = NewError(ERROR_DB_OPERATE_FAIELD, "[buyfollowerHandler] query.Apply failed. error=%v", err)
+		return NewError(ERROR_INTERNAL, "[fromBson] decode %T failed. error=%v", resp, err)
 	}
-	checkError(err)
 
-	item := PushItem{&order, userId}
-	gobalPushManger.Add(&item)
-
-	respInfo := bson.M{"coins": result["coins"]}
-	responseToClient(w, respInfo)
+	return nil
 }
 
-func coinsHandler(w http.ResponseWriter, r *http.Request) {
-	r.ParseForm()
+// getUsers hands the buyers the user should follow next to respond, see PushManager.push.
+func getUsers(ctx context.Context, app *App, userId string, respond func(userIds []string) error) error {
+	if err := checkWritable(); err != nil {
+		return err
+	}
 
-	checkError(validCoinsUrlParam(r.Form))
+	return app.PushManager.push(ctx, userId, currentConfig().PushBatchSize, respond)
+}
 
-	session := gobalMgoSession.Copy()
-	defer session.Close()
+// respondUsers answers the buyers of getUsers as GetUserResponse.
+func respondUsers(w http.ResponseWriter) func(userIds []string) error {
+	return func(userIds []string) error {
+		return responseToClient(w, GetUserResponse{userIds})
+	}
+}
 
-	collection := session.DB("follower").C("user")
+// buyFollowers spends coins of the user on an order of value followers.
+func buyFollowers(ctx context.Context, app *App, userId string, coins int64, value int64) (BuyFollowerResponse, error) {
+	var result BuyFollowerResponse
+	if err := checkWritable(); err != nil {
+		return result, err
+	}
 
-	userId := r.Form["userId"][0]
-	coins := r.Form["coins"][0]
-	coinsInt, _ := strconv.Atoi(coins)
+	if price := value * app.CoinsPerFollower; coins < price {
+		return result, NewValidationError("BuyFollowerRequest", []Violation{{"coins", fmt.Sprintf("must be at least %v for %v followers", price, value)}})
+	}
 
-	queryStatement := bson.M{"userId": userId}
-	change := mgo.Change{Update: bson.M{"$inc": bson.M{"coins": int64(coinsInt)}}, ReturnNew: true}
+	order := Order{
+		fmt.Sprintf("%v", uuid.NewV4()),
+		time.Now().Unix(),
+		coins,
+		value,
+		0, false,
+	}
 
-	var result bson.M
-	_, err := collection.Find(queryStatement).Apply(change, &result)
+	session, err := newDbSession(ctx)
 	if err != nil {
-		if err == mgo.ErrNotFound {
-			err = NewError(ERROR_USER_NOT_FOUND, "[coinsHandler] collection.Apply failed. error=%v", err)
-		} else {
-			err = NewError(ERROR_DB_OPERATE_FAIELD, "[coinsHandler] collection.Apply failed. error=%v", err)
-		}
+		return result, err
 	}
-	checkError(err)
+	defer session.Close()
+
+	collection := app.Collection(session)
 
-	delete(result, "_id")
-	delete(result, "orders")
-	delete(result, "lastPushDate")
+	queryStatement := bson.M{"userId": userId, "coins": bson.M{"$gte": coins}}
+	query := collection.Find(queryStatement)
+	change := mgo.Change{Update: bson.M{"$inc": bson.M{"coins": -coins}, "$addToSet": bson.M{"orders": order}}, ReturnNew: true}
+	_, span := startDbSpan(ctx, "findAndModify", collection)
+	err = dbDo(ctx, func() error {
+		_, err := query.Apply(change, &result)
+		return err
+	})
+	endSpan(span, err)
+	if err == mgo.ErrNotFound {
+		return result, insufficientCoins(ctx, session, collection, userId, coins)
+	} else if err != nil {
+		return result, dbError(ctx, err, ERROR_DB_OPERATE_FAIELD, "[buyFollowers] query.Apply failed. error=%v", err)
+	}
+	gobalUserCache.Remove(userCacheKey(app, "info", userId), userCacheKey(app, "progress", userId))
 
-	responseToClient(w, result)
+	item := PushItem{&order, userId}
+	app.PushManager.Add(ctx, &item)
+
+	return result, nil
 }
 
-func validCoinsUrlParam(values url.Values) error {
+// insufficientCoins tells why buyFollowers matched no user: ERROR_USER_NOT_FOUND if userId
+// is unknown, or else ERROR_INSUFFICIENT_COINS.
+func insufficientCoins(ctx context.Context, session *mgo.Session, collection *mgo.Collection, userId string, coins int64) error {
+	var n int
+	_, span := startDbSpan(ctx, "count", collection)
+	err := dbRetry(ctx, session, func() (err error) {
+		n, err = collection.Find(bson.M{"userId": userId}).Count()
+		return err
+	})
+	endSpan(span, err)
+	if err != nil {
+		return dbError(ctx, err, ERROR_DB_OPERATE_FAIELD, "[buyFollowers] query.Count failed. error=%v", err)
+	}
+	if n == 0 {
+		return NewError(ERROR_USER_NOT_FOUND, "[buyFollowers] user not found. userId=%v", userId)
+	}
+
+	return NewError(ERROR_INSUFFICIENT_COINS, "[buyFollowers] not enough coins. userId=%v coins=%v", userId, coins)
+}
 
-	if _, ok := values["userId"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validCoinsUrlParam] url no userId param")
+// addCoins adds coins, which may be negative, to the user.
+func addCoins(ctx context.Context, app *App, userId string, coins int64) (CoinsResponse, error) {
+	var result CoinsResponse
+	if err := checkWritable(); err != nil {
+		return result, err
 	}
 
-	id := values["userId"][0]
-	if len(id) != USERID_LEN {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validInfoUrlParam] len(id) != USERID_LEN.")
+	session, err := newDbSession(ctx)
+	if err != nil {
+		return result, err
 	}
+	defer session.Close()
+
+	collection := app.Collection(session)
+	queryStatement := bson.M{"userId": userId}
+	change := mgo.Change{Update: bson.M{"$inc": bson.M{"coins": coins}}, ReturnNew: true}
 
-	if _, ok := values["version"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validCoinsUrlParam] url no version param")
+	_, span := startDbSpan(ctx, "findAndModify", collection)
+	err = dbDo(ctx, func() error {
+		_, err := collection.Find(queryStatement).Apply(change, &result)
+		return err
+	})
+	endSpan(span, err)
+	if err == mgo.ErrNotFound {
+		return result, NewError(ERROR_USER_NOT_FOUND, "[addCoins] collection.Apply failed. error=%v", err)
+	} else if err != nil {
+		return result, dbError(ctx, err, ERROR_DB_OPERATE_FAIELD, "[addCoins] collection.Apply failed. error=%v", err)
 	}
+	gobalUserCache.Remove(userCacheKey(app, "info", userId))
 
-	version := values["version"][0]
-	if !validVersion(version) {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validInfoUrlParaml] version invalid. version=%v", version)
+	return result, nil
+}
+
+func CreateNewUser(ctx context.Context, app *App, userId string) error {
+	doc := bson.M{
+		"userId":       userId,
+		"coins":        int64(0),
+		"lastPushDate": int64(0),
 	}
 
-	if _, ok := values["coins"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validCoinsUrlParam] url no coins param")
+	session, err := newDbSession(ctx)
+	if err != nil {
+		return err
 	}
+	defer session.Close()
 
-	coins := values["coins"][0]
-	_, err := strconv.Atoi(coins)
+	collection := app.Collection(session)
+	_, span := startDbSpan(ctx, "insert", collection)
+	err = dbDo(ctx, func() error { return collection.Insert(doc) })
+	endSpan(span, err)
 	if err != nil {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validInfoUrlParaml] coins invalid. coins=%v", coins)
+		return dbError(ctx, err, ERROR_DB_OPERATE_FAIELD, "[CreateNewUser] collection.Insert failed. error=%v", err.Error())
 	}
 
 	return nil
 }
 
-func queryProgress(values url.Values) (bson.M, error) {
-	session := gobalMgoSession.Copy()
+func queryProgress(ctx context.Context, app *App, userId string) (bson.M, error) {
+	session, err := newDbSession(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer session.Close()
 
-	collection := session.DB("follower").C("user")
-	queryStatement := bson.M{"userId": values["userId"][0]}
+	collection := app.Collection(session)
+	queryStatement := bson.M{"userId": userId}
 	selectorStatement := bson.M{"_id": 0, "userId": 1, "orders.fans": 1, "orders.progress": 1, "orders.status": 1}
 	query := collection.Find(queryStatement).Select(selectorStatement)
 
 	var result bson.M
-	err := query.One(&result)
+	_, span := startDbSpan(ctx, "find", collection)
+	err = dbRetry(ctx, session, func() error { return query.One(&result) })
+	endSpan(span, err)
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			err = NewError(ERROR_USER_NOT_FOUND, "[queryProgress] query.one failed. error=%v", err.Error())
 			return nil, err
 		} else {
-			err = NewError(ERROR_DB_OPERATE_FAIELD, "[queryProgress] query.one failed. error=%v", err.Error())
+			err = dbError(ctx, err, ERROR_DB_OPERATE_FAIELD, "[queryProgress] query.one failed. error=%v", err.Error())
 			return nil, err
 		}
 	}
@@ -224,24 +353,29 @@ func queryProgress(values url.Values) (bson.M, error) {
 	return result, nil
 }
 
-func queryInfo(userId string) (bson.M, error) {
-	session := gobalMgoSession.Copy()
+func queryInfo(ctx context.Context, app *App, userId string) (bson.M, error) {
+	session, err := newDbSession(ctx)
+	if err != nil {
+		return nil, err
+	}
 	defer session.Close()
 
-	collection := session.DB("follower").C("user")
+	collection := app.Collection(session)
 
 	queryStatemnt := bson.M{"userId": userId}
 	selectorStatement := bson.M{"_id": 0, "userId": 1, "coins": 1, "orders.fans": 1, "orders.progress": 1, "orders.status": 1}
 	query := collection.Find(queryStatemnt).Select(selectorStatement)
 
 	var result bson.M
-	err := query.One(&result)
+	_, span := startDbSpan(ctx, "find", collection)
+	err = dbRetry(ctx, session, func() error { return query.One(&result) })
+	endSpan(span, err)
 	if err != nil {
 		if err == mgo.ErrNotFound {
 			err = NewError(ERROR_USER_NOT_FOUND, "[queryInfo] query.one failed.  error=%v", err.Error())
 			return nil, err
 		} else {
-			err = NewError(ERROR_DB_OPERATE_FAIELD, "[queryInfo] query.one failed. error=%v", err.Error())
+			err = dbError(ctx, err, ERROR_DB_OPERATE_FAIELD, "[queryInfo] query.one failed. error=%v", err.Error())
 			return nil, err
 		}
 	}
@@ -250,12 +384,15 @@ func queryInfo(userId string) (bson.M, error) {
 }
 
 func responseToClient(w http.ResponseWriter, info interface{}) error {
-	w.WriteHeader(200)
-
 	respByte, err := json.Marshal(info)
 	if err != nil {
 		return NewError(ERROR_INTERNAL, "[responseToClient] json.Marshal failed. error=%v", err)
 	}
+
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.WriteHeader(200)
 	_, err = io.WriteString(w, string(respByte))
 	if err != nil {
 		return NewError(ERROR_INTERNAL, "[responseToClient] io.WriteString failed. error=%v", err)
@@ -263,103 +400,3 @@ func responseToClient(w http.ResponseWriter, info interface{}) error {
 
 	return nil
 }
-
-func validBuyFollowerUrlParam(values url.Values) error {
-	if _, ok := values["userId"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validBuyFollowerUrlParam] url no userId param")
-	}
-
-	id := values["userId"][0]
-	if len(id) != USERID_LEN {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validBuyFollowerUrlParam] len(id) != USERID_LEN.")
-	}
-
-	if _, ok := values["version"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validBuyFollowerUrlParam] url no version param")
-	}
-
-	version := values["version"][0]
-	if !validVersion(version) {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validBuyFollowerUrlParam] version invalid. version=%v", version)
-	}
-
-	if _, ok := values["coins"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validBuyFollowerUrlParam] url no coins param")
-	}
-
-	coins := values["coins"][0]
-	coinsInt, err := strconv.Atoi(coins)
-	if err != nil || coinsInt == 0 {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validBuyFollowerUrlParam] coins invalid. conins:%v", coins)
-	}
-
-	if _, ok := values["value"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validBuyFollowerUrlParam] url no value param")
-	}
-
-	followers := values["value"][0]
-	followersInt, err := strconv.Atoi(followers)
-	if err != nil || followersInt == 0 {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validBuyFollowerUrlParam] followers count invalid. count:%v", followers)
-	}
-
-	return nil
-}
-
-func validProgressUrlParam(values url.Values) error {
-	if _, ok := values["userId"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validProgressUrlParam] url no userId param")
-	}
-
-	id := values["userId"][0]
-	if len(id) != USERID_LEN {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validInfoUrlParam] len(id) != USERID_LEN.")
-	}
-
-	if _, ok := values["version"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validProgressUrlParam] url no version param")
-	}
-
-	version := values["version"][0]
-	if !validVersion(version) {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validInfoUrlParaml] version invalid. version=%v", version)
-	}
-
-	return nil
-}
-
-func validInfoUrlParam(values url.Values) error {
-	if _, ok := values["userId"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validInfoUrlParam] url no userId param")
-	}
-
-	id := values["userId"][0]
-	if len(id) != USERID_LEN {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validInfoUrlParam] len(id) != USERID_LEN.")
-	}
-
-	if _, ok := values["version"]; !ok {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validInfoUrlParam] url no version param")
-	}
-
-	version := values["version"][0]
-	if !validVersion(version) {
-		return NewError(ERROR_URL_PARAM_INVALID, "[validInfoUrlParaml] version invalid. version=%v", version)
-	}
-
-	return nil
-}
-
-func validVersion(v string) bool {
-	intV, err := strconv.Atoi(v)
-	if err != nil {
-		return false
-	}
-
-	switch intV {
-	case 1:
-		return true
-	default:
-		return false
-	}
-}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/satori/go.uuid"
@@ -34,6 +35,15 @@ type FollowerHandlerSuite struct {
 	session    *mgo.Session
 }
 
+func (p *FollowerHandlerSuite) SetUpSuite(c *C) {
+	gobalConfig.DbName = testGobalDbName
+	gobalConfig.CollName = testGobalCollName
+	gobalConfig.UserIdLen = DefaultUserIdLen
+	gobalConfig.PushBatchSize = DefaultPushBatchSize
+	gobalConfig.Versions = DefaultVersions
+	initApps()
+}
+
 func (p *FollowerHandlerSuite) SetUpTest(c *C) {
 	orderCount := 2
 	coins := int64(20)
@@ -116,6 +126,66 @@ func (p *FollowerHandlerSuite) TearDownTest(c *C) {
 	p.cleanTestDataIfExist(c, collection, p.userId)
 }
 
+// Test_push_completesOrder pushes the last follower of an order, which removes the order
+// from the PushManager while push holds its lock.
+func (p *FollowerHandlerSuite) Test_push_completesOrder(c *C) {
+	manager := NewPushManager(testGobalDbName, testGobalCollName)
+	order := &Order{OrderId: p.OrderIds[0], Date: time.Now().Unix(), Coins: 10, Fans: 1}
+	manager.Add(context.Background(), &PushItem{order, p.userId})
+
+	var pushed []string
+	err := manager.push(context.Background(), p.userId, 1, func(userIds []string) error {
+		pushed = userIds
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(pushed, DeepEquals, []string{p.userId})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	c.Assert(manager.lock(ctx), IsNil)
+	manager.unlock()
+	c.Assert(manager.Len(), Equals, 0)
+
+	var result bson.M
+	collection := p.session.DB(testGobalDbName).C(testGobalCollName)
+	err = collection.Find(bson.M{"orders.orderId": p.OrderIds[0]}).Select(bson.M{"orders.$": 1}).One(&result)
+	c.Assert(err, IsNil)
+	c.Assert(result["orders"].([]interface{})[0].(bson.M)["status"], Equals, true)
+}
+
+// Test_push_respondsAfterUpdate checks that respond sees the progress already stored.
+func (p *FollowerHandlerSuite) Test_push_respondsAfterUpdate(c *C) {
+	manager := NewPushManager(testGobalDbName, testGobalCollName)
+	order := &Order{OrderId: p.OrderIds[1], Date: time.Now().Unix(), Coins: 10, Fans: 2}
+	manager.Add(context.Background(), &PushItem{order, p.userId})
+
+	collection := p.session.DB(testGobalDbName).C(testGobalCollName)
+	err := manager.push(context.Background(), p.userId, 1, func(userIds []string) error {
+		var result bson.M
+		err := collection.Find(bson.M{"orders.orderId": p.OrderIds[1]}).Select(bson.M{"orders.$": 1}).One(&result)
+		c.Assert(err, IsNil)
+		c.Assert(result["orders"].([]interface{})[0].(bson.M)["progress"], Equals, int64(1))
+		return nil
+	})
+	c.Assert(err, IsNil)
+}
+
+func (p *FollowerHandlerSuite) Test_buyFollowers_insufficientCoins(c *C) {
+	_, err := buyFollowers(context.Background(), gobalApps.Default(), p.userId, p.Coins+1, 1)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_INSUFFICIENT_COINS)
+}
+
+func (p *FollowerHandlerSuite) Test_buyFollowers_userIdNotExist(c *C) {
+	collection := p.session.DB(testGobalDbName).C(testGobalCollName)
+	p.cleanTestDataIfExist(c, collection, testGobalUserIdNotExist)
+
+	_, err := buyFollowers(context.Background(), gobalApps.Default(), testGobalUserIdNotExist, 1, 1)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_USER_NOT_FOUND)
+}
+
 func (p *FollowerHandlerSuite) Test_counterHander(c *C) {
 
 }
@@ -126,7 +196,7 @@ func (p *FollowerHandlerSuite) Test_coinsHandler(c *C) {
 
 	request := httptest.NewRequest("GET", url, nil)
 	w := httptest.NewRecorder()
-	coinsHandler(w, request)
+	c.Assert(coinsHandler(w, request), IsNil)
 	if w.Code != 200 {
 		c.Fatal(w.Body.String())
 	}
@@ -147,69 +217,41 @@ func (p *FollowerHandlerSuite) Test_coinsHander_userIdNotExist(c *C) {
 
 	url := fmt.Sprintf("https://%v/getfollowers/coins?userId=%v&version=%v&coins=%v", testGobalHttpAddr, testGobalUserIdNotExist, testGobalVersion, 0)
 
-	defer func() {
-		if err, ok := recover().(FollowerError); ok {
-			c.Assert(err.Code, Equals, ERROR_USER_NOT_FOUND)
-		} else {
-			c.Fatal("not FollowerError")
-		}
-	}()
-
 	request := httptest.NewRequest("GET", url, nil)
 	recorder := httptest.NewRecorder()
-	coinsHandler(recorder, request)
-	c.Fatal("no error found")
+	err := coinsHandler(recorder, request)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_USER_NOT_FOUND)
 }
 
 func (p *FollowerHandlerSuite) Test_coinsHander_invalidUrl_noVersion(c *C) {
 	url := fmt.Sprintf("https://%v/getfollowers/coins?userId=%v&coins=%v", testGobalHttpAddr, p.userId, 0)
 
-	defer func() {
-		if err, ok := recover().(FollowerError); ok {
-			c.Assert(err.Code, Equals, ERROR_URL_PARAM_INVALID)
-		} else {
-			c.Fatal("not FollowerError")
-		}
-	}()
-
 	request := httptest.NewRequest("GET", url, nil)
 	recorder := httptest.NewRecorder()
-	coinsHandler(recorder, request)
-	c.Fatal("no error found")
+	err := coinsHandler(recorder, request)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_URL_PARAM_INVALID)
 }
 
 func (p *FollowerHandlerSuite) Test_coinsHander_invalidUrl_noUserId(c *C) {
 	url := fmt.Sprintf("https://%v/getfollowers/coins?version=%v&coins=%v", testGobalHttpAddr, testGobalVersion, 0)
 
-	defer func() {
-		if err, ok := recover().(FollowerError); ok {
-			c.Assert(err.Code, Equals, ERROR_URL_PARAM_INVALID)
-		} else {
-			c.Fatal("not FollowerError")
-		}
-	}()
-
 	request := httptest.NewRequest("GET", url, nil)
 	recorder := httptest.NewRecorder()
-	coinsHandler(recorder, request)
-	c.Fatal("no error found")
+	err := coinsHandler(recorder, request)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_URL_PARAM_INVALID)
 }
 
 func (p *FollowerHandlerSuite) Test_coinsHander_invalidUrl_noCoins(c *C) {
 	url := fmt.Sprintf("https://%v/getfollowers/coins?version=%v&userId=%v", testGobalHttpAddr, testGobalVersion, p.userId)
 
-	defer func() {
-		if err, ok := recover().(FollowerError); ok {
-			c.Assert(err.Code, Equals, ERROR_URL_PARAM_INVALID)
-		} else {
-			c.Fatal("not FollowerError")
-		}
-	}()
-
 	request := httptest.NewRequest("GET", url, nil)
 	recorder := httptest.NewRecorder()
-	coinsHandler(recorder, request)
-	c.Fatal("no error found")
+	err := coinsHandler(recorder, request)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_URL_PARAM_INVALID)
 }
 
 func (p *FollowerHandlerSuite) Test_infoHandler(c *C) {
@@ -217,7 +259,7 @@ func (p *FollowerHandlerSuite) Test_infoHandler(c *C) {
 
 	request := httptest.NewRequest("GET", url, nil)
 	w := httptest.NewRecorder()
-	infoHandler(w, request)
+	c.Assert(infoHandler(w, request), IsNil)
 	if w.Code != 200 {
 		c.Fatal(w.Body.String())
 	}
@@ -241,7 +283,7 @@ func (p *FollowerHandlerSuite) Test_infoHandler_userIdNotExist(c *C) {
 
 	request := httptest.NewRequest("GET", url, nil)
 	w := httptest.NewRecorder()
-	infoHandler(w, request)
+	c.Assert(infoHandler(w, request), IsNil)
 	if w.Code != 200 {
 		c.Fatal(w.Body.String())
 	}
@@ -261,37 +303,21 @@ func (p *FollowerHandlerSuite) Test_infoHandler_userIdNotExist(c *C) {
 func (p *FollowerHandlerSuite) Test_infoHandler_invalidUrl_noUserId(c *C) {
 	url := fmt.Sprintf("https://%v/getfollowers/info?version=%v", testGobalHttpAddr, testGobalVersion)
 
-	defer func() {
-		if err, ok := recover().(FollowerError); ok {
-			c.Assert(err.Code, Equals, ERROR_URL_PARAM_INVALID)
-		} else {
-			c.Fatal(err)
-		}
-	}()
-
 	request := httptest.NewRequest("GET", url, nil)
 	w := httptest.NewRecorder()
-	infoHandler(w, request)
-
-	c.Fatal("no error")
+	err := infoHandler(w, request)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_URL_PARAM_INVALID)
 }
 
 func (p *FollowerHandlerSuite) Test_infoHandler_invalidUrl_noVersion(c *C) {
 	url := fmt.Sprintf("https://%v/getfollowers/info?userId=%v", testGobalHttpAddr, p.userId)
 
-	defer func() {
-		if err, ok := recover().(FollowerError); ok {
-			c.Assert(err.Code, Equals, ERROR_URL_PARAM_INVALID)
-		} else {
-			c.Fatal(err)
-		}
-	}()
-
 	request := httptest.NewRequest("GET", url, nil)
 	w := httptest.NewRecorder()
-	infoHandler(w, request)
-
-	c.Fatal("no error")
+	err := infoHandler(w, request)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_URL_PARAM_INVALID)
 }
 
 func (p *FollowerHandlerSuite) Test_progressHandler(c *C) {
@@ -299,7 +325,7 @@ func (p *FollowerHandlerSuite) Test_progressHandler(c *C) {
 
 	request := httptest.NewRequest("GET", url, nil)
 	w := httptest.NewRecorder()
-	infoHandler(w, request)
+	c.Assert(infoHandler(w, request), IsNil)
 	if w.Code != 200 {
 		c.Fatal(w.Body.String())
 	}
@@ -322,18 +348,11 @@ func (p *FollowerHandlerSuite) Test_progressHandler_userIdNotExist(c *C) {
 	collection := p.session.DB(testGobalDbName).C(testGobalCollName)
 	p.cleanTestDataIfExist(c, collection, testGobalUserIdNotExist)
 
-	defer func() {
-		if err, ok := recover().(FollowerError); ok {
-			c.Assert(err.Code, Equals, ERROR_USER_NOT_FOUND)
-		} else {
-			c.Fatal("not FollowerError")
-		}
-	}()
-
 	request := httptest.NewRequest("GET", url, nil)
 	w := httptest.NewRecorder()
-	progressHandler(w, request)
-	c.Fatal("no error found")
+	err := progressHandler(w, request)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_USER_NOT_FOUND)
 }
 
 func (p *FollowerHandlerSuite) Test_progressHandler_invalidUrl_noUserId(c *C) {
@@ -342,18 +361,11 @@ func (p *FollowerHandlerSuite) Test_progressHandler_invalidUrl_noUserId(c *C) {
 	collection := p.session.DB(testGobalDbName).C(testGobalCollName)
 	p.cleanTestDataIfExist(c, collection, testGobalUserIdNotExist)
 
-	defer func() {
-		if err, ok := recover().(FollowerError); ok {
-			c.Assert(err.Code, Equals, ERROR_URL_PARAM_INVALID)
-		} else {
-			c.Fatal("not FollowerError")
-		}
-	}()
-
 	request := httptest.NewRequest("GET", url, nil)
 	w := httptest.NewRecorder()
-	progressHandler(w, request)
-	c.Fatal("no error found")
+	err := progressHandler(w, request)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_URL_PARAM_INVALID)
 }
 
 func (p *FollowerHandlerSuite) Test_progressHandler_invalidUrl_noVersion(c *C) {
@@ -362,16 +374,9 @@ func (p *FollowerHandlerSuite) Test_progressHandler_invalidUrl_noVersion(c *C) {
 	collection := p.session.DB(testGobalDbName).C(testGobalCollName)
 	p.cleanTestDataIfExist(c, collection, testGobalUserIdNotExist)
 
-	defer func() {
-		if err, ok := recover().(FollowerError); ok {
-			c.Assert(err.Code, Equals, ERROR_URL_PARAM_INVALID)
-		} else {
-			c.Fatal("not FollowerError")
-		}
-	}()
-
 	request := httptest.NewRequest("GET", url, nil)
 	w := httptest.NewRecorder()
-	progressHandler(w, request)
-	c.Fatal("no error found")
+	err := progressHandler(w, request)
+	c.Assert(err, NotNil)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_URL_PARAM_INVALID)
 }
@@ -0,0 +1,333 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: followerpb/follower.proto
+
+// follower is the grpc service of the client api. Its methods share the maintenance, rate
+// limits and idempotency keys of the http routes of the same operation. The error code and
+// name of a failed call are on the follower-error-code and follower-error-name trailers.
+
+package followerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Follower_Coins_FullMethodName         = "/follower.Follower/Coins"
+	Follower_Info_FullMethodName          = "/follower.Follower/Info"
+	Follower_BuyFollower_FullMethodName   = "/follower.Follower/BuyFollower"
+	Follower_GetUser_FullMethodName       = "/follower.Follower/GetUser"
+	Follower_Progress_FullMethodName      = "/follower.Follower/Progress"
+	Follower_WatchProgress_FullMethodName = "/follower.Follower/WatchProgress"
+)
+
+// FollowerClient is the client API for Follower service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type FollowerClient interface {
+	// Coins adds coins, which may be negative, to the user.
+	Coins(ctx context.Context, in *CoinsRequest, opts ...grpc.CallOption) (*CoinsResponse, error)
+	// Info returns the coins and orders of the user, who is created if unknown.
+	Info(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*InfoResponse, error)
+	// BuyFollower spends coins of the user on value followers.
+	BuyFollower(ctx context.Context, in *BuyFollowerRequest, opts ...grpc.CallOption) (*BuyFollowerResponse, error)
+	// GetUser returns the buyers the user should follow next.
+	GetUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*GetUserResponse, error)
+	// Progress returns the orders of the user.
+	Progress(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*ProgressResponse, error)
+	// WatchProgress sends the progress of the user whenever it changes, until every order is
+	// complete or the client cancels.
+	WatchProgress(ctx context.Context, in *WatchProgressRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProgressResponse], error)
+}
+
+type followerClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewFollowerClient(cc grpc.ClientConnInterface) FollowerClient {
+	return &followerClient{cc}
+}
+
+func (c *followerClient) Coins(ctx context.Context, in *CoinsRequest, opts ...grpc.CallOption) (*CoinsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CoinsResponse)
+	err := c.cc.Invoke(ctx, Follower_Coins_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followerClient) Info(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*InfoResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(InfoResponse)
+	err := c.cc.Invoke(ctx, Follower_Info_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followerClient) BuyFollower(ctx context.Context, in *BuyFollowerRequest, opts ...grpc.CallOption) (*BuyFollowerResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BuyFollowerResponse)
+	err := c.cc.Invoke(ctx, Follower_BuyFollower_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followerClient) GetUser(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*GetUserResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetUserResponse)
+	err := c.cc.Invoke(ctx, Follower_GetUser_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followerClient) Progress(ctx context.Context, in *UserRequest, opts ...grpc.CallOption) (*ProgressResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ProgressResponse)
+	err := c.cc.Invoke(ctx, Follower_Progress_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *followerClient) WatchProgress(ctx context.Context, in *WatchProgressRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[ProgressResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Follower_ServiceDesc.Streams[0], Follower_WatchProgress_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchProgressRequest, ProgressResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Follower_WatchProgressClient = grpc.ServerStreamingClient[ProgressResponse]
+
+// FollowerServer is the server API for Follower service.
+// All implementations must embed UnimplementedFollowerServer
+// for forward compatibility.
+type FollowerServer interface {
+	// Coins adds coins, which may be negative, to the user.
+	Coins(context.Context, *CoinsRequest) (*CoinsResponse, error)
+	// Info returns the coins and orders of the user, who is created if unknown.
+	Info(context.Context, *UserRequest) (*InfoResponse, error)
+	// BuyFollower spends coins of the user on value followers.
+	BuyFollower(context.Context, *BuyFollowerRequest) (*BuyFollowerResponse, error)
+	// GetUser returns the buyers the user should follow next.
+	GetUser(context.Context, *UserRequest) (*GetUserResponse, error)
+	// Progress returns the orders of the user.
+	Progress(context.Context, *UserRequest) (*ProgressResponse, error)
+	// WatchProgress sends the progress of the user whenever it changes, until every order is
+	// complete or the client cancels.
+	WatchProgress(*WatchProgressRequest, grpc.ServerStreamingServer[ProgressResponse]) error
+	mustEmbedUnimplementedFollowerServer()
+}
+
+// UnimplementedFollowerServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFollowerServer struct{}
+
+func (UnimplementedFollowerServer) Coins(context.Context, *CoinsRequest) (*CoinsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Coins not implemented")
+}
+func (UnimplementedFollowerServer) Info(context.Context, *UserRequest) (*InfoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Info not implemented")
+}
+func (UnimplementedFollowerServer) BuyFollower(context.Context, *BuyFollowerRequest) (*BuyFollowerResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BuyFollower not implemented")
+}
+func (UnimplementedFollowerServer) GetUser(context.Context, *UserRequest) (*GetUserResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUser not implemented")
+}
+func (UnimplementedFollowerServer) Progress(context.Context, *UserRequest) (*ProgressResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Progress not implemented")
+}
+func (UnimplementedFollowerServer) WatchProgress(*WatchProgressRequest, grpc.ServerStreamingServer[ProgressResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchProgress not implemented")
+}
+func (UnimplementedFollowerServer) mustEmbedUnimplementedFollowerServer() {}
+func (UnimplementedFollowerServer) testEmbeddedByValue()                  {}
+
+// UnsafeFollowerServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to FollowerServer will
+// result in compilation errors.
+type UnsafeFollowerServer interface {
+	mustEmbedUnimplementedFollowerServer()
+}
+
+func RegisterFollowerServer(s grpc.ServiceRegistrar, srv FollowerServer) {
+	// If the following call pancis, it indicates UnimplementedFollowerServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Follower_ServiceDesc, srv)
+}
+
+func _Follower_Coins_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CoinsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowerServer).Coins(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Follower_Coins_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowerServer).Coins(ctx, req.(*CoinsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Follower_Info_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowerServer).Info(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Follower_Info_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowerServer).Info(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Follower_BuyFollower_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BuyFollowerRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowerServer).BuyFollower(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Follower_BuyFollower_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowerServer).BuyFollower(ctx, req.(*BuyFollowerRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Follower_GetUser_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowerServer).GetUser(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Follower_GetUser_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowerServer).GetUser(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Follower_Progress_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UserRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FollowerServer).Progress(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Follower_Progress_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FollowerServer).Progress(ctx, req.(*UserRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Follower_WatchProgress_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchProgressRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FollowerServer).WatchProgress(m, &grpc.GenericServerStream[WatchProgressRequest, ProgressResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Follower_WatchProgressServer = grpc.ServerStreamingServer[ProgressResponse]
+
+// Follower_ServiceDesc is the grpc.ServiceDesc for Follower service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Follower_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "follower.Follower",
+	HandlerType: (*FollowerServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Coins",
+			Handler:    _Follower_Coins_Handler,
+		},
+		{
+			MethodName: "Info",
+			Handler:    _Follower_Info_Handler,
+		},
+		{
+			MethodName: "BuyFollower",
+			Handler:    _Follower_BuyFollower_Handler,
+		},
+		{
+			MethodName: "GetUser",
+			Handler:    _Follower_GetUser_Handler,
+		},
+		{
+			MethodName: "Progress",
+			Handler:    _Follower_Progress_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchProgress",
+			Handler:       _Follower_WatchProgress_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "followerpb/follower.proto",
+}
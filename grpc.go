@@ -0,0 +1,633 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"go-web/followerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"reflect"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative followerpb/follower.proto
+
+const (
+	// GrpcServiceName is the service of followerpb/follower.proto.
+	GrpcServiceName = "follower.Follower"
+
+	// metadata of the calls. The app, request id and idempotency key are read from the
+	// request, the error code and name are set on the trailer of failed calls.
+	GrpcAppMetadata                = "app"
+	GrpcRequestIdMetadata          = "x-request-id"
+	GrpcIdempotencyKeyMetadata     = "idempotency-key"
+	GrpcIdempotentReplayedMetadata = "idempotent-replayed"
+	GrpcRetryAfterMetadata         = "retry-after"
+	GrpcErrorCodeMetadata          = "follower-error-code"
+	GrpcErrorNameMetadata          = "follower-error-name"
+
+	DefaultWatchInterval  = time.Second
+	DefaultGrpcMaxWatches = 1000
+)
+
+// WatchProgressRequest is the request of WatchProgress. IntervalMs is the polling interval,
+// DefaultWatchInterval if 0.
+type WatchProgressRequest struct {
+	UserId     string `param:"userId" validate:"required,userid" json:"userId"`
+	IntervalMs int64  `param:"intervalMs" validate:"min=100,max=60000" json:"intervalMs"`
+}
+
+// FollowerServer serves followerpb.FollowerServer with the service functions of the http
+// handlers. The messages are checked against the v2 requests, and the v2 responses are
+// converted to their messages.
+type FollowerServer struct {
+	followerpb.UnimplementedFollowerServer
+}
+
+var gobalGrpcServer *grpc.Server
+
+// Watches counts the running WatchProgress streams, which are not client requests of
+// gobalCounter as they last.
+type Watches struct {
+	running int64
+	total   int64
+}
+
+var gobalWatches Watches
+
+// Acquire takes a slot for a watch, or returns false if max are running. max 0 is no limit.
+func (p *Watches) Acquire(max int) bool {
+	if running := atomic.AddInt64(&p.running, 1); max > 0 && running > int64(max) {
+		atomic.AddInt64(&p.running, -1)
+		return false
+	}
+
+	atomic.AddInt64(&p.total, 1)
+	return true
+}
+
+func (p *Watches) Release() {
+	atomic.AddInt64(&p.running, -1)
+}
+
+func (p *Watches) Running() int64 {
+	return atomic.LoadInt64(&p.running)
+}
+
+func (p *Watches) Total() int64 {
+	return atomic.LoadInt64(&p.total)
+}
+
+func (p *FollowerServer) Coins(ctx context.Context, in *followerpb.CoinsRequest) (*followerpb.CoinsResponse, error) {
+	var req CoinsRequestV2
+	if err := grpcRequest(in, &req); err != nil {
+		return nil, err
+	}
+
+	result, err := addCoins(ctx, appFromContext(ctx), req.UserId, req.Coins)
+	if err != nil {
+		return nil, err
+	}
+
+	return &followerpb.CoinsResponse{UserId: result.UserId, Coins: result.Coins}, nil
+}
+
+func (p *FollowerServer) Info(ctx context.Context, in *followerpb.UserRequest) (*followerpb.InfoResponse, error) {
+	var req UserRequestV2
+	if err := grpcRequest(in, &req); err != nil {
+		return nil, err
+	}
+
+	result, err := getInfo(ctx, appFromContext(ctx), req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &followerpb.InfoResponse{
+		UserId:   result.UserId,
+		Coins:    result.Coins,
+		Orders:   orderProgressMessages(result.Orders),
+		Stale:    result.Stale,
+		CachedAt: result.CachedAt,
+	}, nil
+}
+
+func (p *FollowerServer) BuyFollower(ctx context.Context, in *followerpb.BuyFollowerRequest) (*followerpb.BuyFollowerResponse, error) {
+	var req BuyFollowerRequestV2
+	if err := grpcRequest(in, &req); err != nil {
+		return nil, err
+	}
+
+	result, err := buyFollowers(ctx, appFromContext(ctx), req.UserId, req.Coins, req.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &followerpb.BuyFollowerResponse{Coins: result.Coins}, nil
+}
+
+func (p *FollowerServer) GetUser(ctx context.Context, in *followerpb.UserRequest) (*followerpb.GetUserResponse, error) {
+	var req UserRequestV2
+	if err := grpcRequest(in, &req); err != nil {
+		return nil, err
+	}
+
+	var resp followerpb.GetUserResponse
+	err := getUsers(ctx, appFromContext(ctx), req.UserId, func(userIds []string) error {
+		resp.UserIds = userIds
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (p *FollowerServer) Progress(ctx context.Context, in *followerpb.UserRequest) (*followerpb.ProgressResponse, error) {
+	var req UserRequestV2
+	if err := grpcRequest(in, &req); err != nil {
+		return nil, err
+	}
+
+	result, err := getProgress(ctx, appFromContext(ctx), req.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	return progressMessage(result), nil
+}
+
+// WatchProgress sends the progress of the user whenever it changes, until every order is
+// complete or the client cancels. Every poll runs under its own RequestTimeout.
+func (p *FollowerServer) WatchProgress(in *followerpb.WatchProgressRequest, stream followerpb.Follower_WatchProgressServer) error {
+	var req WatchProgressRequest
+	if err := grpcRequest(in, &req); err != nil {
+		return err
+	}
+
+	interval := DefaultWatchInterval
+	if req.IntervalMs != 0 {
+		interval = time.Duration(req.IntervalMs) * time.Millisecond
+	}
+
+	ctx := stream.Context()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var last *followerpb.ProgressResponse
+	for {
+		pollCtx, cancel := context.WithTimeout(ctx, currentConfig().RequestTimeout)
+		progress, err := getProgress(pollCtx, appFromContext(ctx), req.UserId)
+		cancel()
+		if err != nil {
+			return err
+		}
+
+		// the cached results differ by cachedAt only.
+		current := progressMessage(progress)
+		current.CachedAt = 0
+		if last == nil || !proto.Equal(current, last) {
+			if err := stream.Send(current); err != nil {
+				return err
+			}
+			last = current
+		}
+		if progressComplete(progress) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// progressComplete reports whether the user has orders and all of them are complete.
+func progressComplete(progress ProgressResponse) bool {
+	for _, order := range progress.Orders {
+		if !order.Status {
+			return false
+		}
+	}
+
+	return len(progress.Orders) != 0
+}
+
+func progressMessage(progress ProgressResponse) *followerpb.ProgressResponse {
+	return &followerpb.ProgressResponse{
+		UserId:   progress.UserId,
+		Orders:   orderProgressMessages(progress.Orders),
+		Stale:    progress.Stale,
+		CachedAt: progress.CachedAt,
+	}
+}
+
+func orderProgressMessages(orders []OrderProgress) []*followerpb.OrderProgress {
+	messages := make([]*followerpb.OrderProgress, 0, len(orders))
+	for _, order := range orders {
+		messages = append(messages, &followerpb.OrderProgress{Fans: order.Fans, Progress: order.Progress, Status: order.Status})
+	}
+
+	return messages
+}
+
+// grpcRequest copies the message into the v2 request struct pointed to by req, and checks it
+// like decodeMessage. The json names of the message fields are the param names, and a
+// field is missing unless the message has it, so that an optional field set to 0 is kept
+// apart from a missing one. It panics on a param without a field, which is a programming
+// error.
+func grpcRequest(message proto.Message, req interface{}) error {
+	m := message.ProtoReflect()
+	fields := m.Descriptor().Fields()
+	v := reflect.ValueOf(req).Elem()
+
+	var violations []Violation
+	for _, spec := range paramSpecs(v.Type()) {
+		field := fields.ByJSONName(spec.Name)
+		if field == nil {
+			panic(fmt.Sprintf("param %v of %v: no field in %v", spec.Name, v.Type(), m.Descriptor().FullName()))
+		}
+		if !m.Has(field) {
+			if spec.Required {
+				violations = append(violations, Violation{spec.Name, "is required"})
+			}
+			continue
+		}
+
+		value := v.Field(spec.field)
+		value.Set(reflect.ValueOf(m.Get(field).Interface()).Convert(value.Type()))
+		if reason := spec.validate(value); reason != "" {
+			violations = append(violations, Violation{spec.Name, reason})
+		}
+	}
+
+	if len(violations) != 0 {
+		return NewValidationError(v.Type().Name(), violations)
+	}
+
+	return nil
+}
+
+// grpcContext attaches the app of the authority and the app metadata, the request id and a
+// logger to ctx, like withApp and requestId do for http.
+func grpcContext(ctx context.Context, method string) (context.Context, error) {
+	app, err := gobalApps.Resolve(incomingMetadata(ctx, ":authority"), incomingMetadata(ctx, GrpcAppMetadata))
+	if err != nil {
+		return ctx, err
+	}
+
+	id := incomingMetadata(ctx, GrpcRequestIdMetadata)
+	if !validRequestId(id) {
+		id = fmt.Sprintf("%v", uuid.NewV4())
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(GrpcRequestIdMetadata, id))
+
+	ctx = context.WithValue(ctx, appContextKey, app)
+	ctx = context.WithValue(ctx, loggerContextKey, log.WithFields(log.Fields{"requestId": id, "app": app.Name, "method": method}))
+	return ctx, nil
+}
+
+// incomingMetadata returns the first value of key in the metadata of the call.
+func incomingMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) != 0 {
+		return values[0]
+	}
+
+	return ""
+}
+
+// grpcOperation returns the operation of the client routes which method serves, e.g.
+// buyfollower for /follower.Follower/BuyFollower. WatchProgress polls progress.
+func grpcOperation(method string) string {
+	if operation := operationOf(method); operation != "watchprogress" {
+		return operation
+	}
+
+	return "progress"
+}
+
+// messageUserId returns the userId of a request, or "" for a nil request.
+func messageUserId(req interface{}) string {
+	if message, ok := req.(interface{ GetUserId() string }); ok {
+		return message.GetUserId()
+	}
+
+	return ""
+}
+
+// peerIP returns the address of the client of the call. The X-Forwarded-For of trusted
+// proxies does not apply, as grpc is not served behind http proxies.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+// grpcStatus turns err into a grpc status carrying the client message of the error catalog,
+// with the error code and name on the trailer. Errors other than FollowerError are logged
+// and answered as ERROR_INTERNAL.
+func grpcStatus(ctx context.Context, err error) (error, metadata.MD) {
+	if err == nil {
+		return nil, nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err, nil
+	}
+
+	e, ok := err.(FollowerError)
+	if !ok {
+		e = NewError(ERROR_INTERNAL, "unexpected error. error=%v", err).(FollowerError)
+	}
+	requestLogger(ctx).WithField("errorCode", fmt.Sprintf("0x%x", e.Code)).Error(e.Error())
+
+	trailer := metadata.Pairs(GrpcErrorCodeMetadata, fmt.Sprintf("%v", e.Code), GrpcErrorNameMetadata, e.Name)
+	return status.Error(grpcCode(httpStatus(e.Code)), e.Msg), trailer
+}
+
+// grpcCode maps the http status of an error code to the closest grpc code.
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusUnsupportedMediaType:
+		return codes.InvalidArgument
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusMethodNotAllowed:
+		return codes.Unimplemented
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusGone, http.StatusUpgradeRequired, http.StatusPaymentRequired:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+
+	return codes.Internal
+}
+
+// grpcGuard applies to every call what the client decorators apply to http: the maintenance
+// switch and the rate limit of the operation of method, then for a unary call with req the
+// concurrency limit, counting and the idempotency key of grpcIdempotent. A watch, with a nil
+// req, lasts and would hold its slot of the concurrency limit all along, so it takes one of
+// grpc_max_watches instead. A panic is answered as ERROR_INTERNAL.
+func grpcGuard(ctx context.Context, method string, req interface{}, call func(ctx context.Context) (interface{}, error)) (resp interface{}, err error) {
+	operation := grpcOperation(method)
+	if state, ok := gobalMaintenance.Active(operation); ok {
+		return nil, maintenanceError(state, method)
+	}
+
+	if wait, err := gobalRateLimiter.Check(operation, routeRateLimit(operation), messageUserId(req), peerIP(ctx)); err != nil {
+		grpc.SetHeader(ctx, metadata.Pairs(GrpcRetryAfterMetadata, strconv.Itoa(int(math.Ceil(wait.Seconds())))))
+		return nil, err
+	}
+
+	if req == nil {
+		if !gobalWatches.Acquire(currentConfig().GrpcMaxWatches) {
+			return nil, NewError(ERROR_SERVER_BUSY, "[grpcGuard] too many watches. method=%v", method)
+		}
+		defer gobalWatches.Release()
+	} else {
+		if gobalConcurrencyLimiter != nil {
+			if !gobalConcurrencyLimiter.Acquire(ctx) {
+				return nil, NewError(ERROR_SERVER_BUSY, "[grpcGuard] server busy. method=%v", method)
+			}
+			defer func(start time.Time) {
+				gobalConcurrencyLimiter.Observe(time.Since(start))
+				gobalConcurrencyLimiter.Release()
+			}(time.Now())
+		}
+
+		defer func(start time.Time) {
+			gobalCounter.AddLatency(time.Since(start).Nanoseconds())
+		}(time.Now())
+		gobalCounter.AddRequest(1)
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			requestLogger(ctx).WithField("stack", string(debug.Stack())).Errorf("panic serving %v. panic=%v", method, v)
+			err = NewError(ERROR_INTERNAL, "[grpcGuard] panic. panic=%v", v)
+		}
+	}()
+
+	if req == nil {
+		return call(ctx)
+	}
+	return grpcIdempotent(ctx, gobalIdempotencyStore, method, req, call)
+}
+
+// grpcIdempotent answers a call of a write method repeating the idempotency-key metadata of
+// an earlier call with the response or error of the earlier call, marked with the
+// idempotent-replayed header, like idempotent does for http. It only calls call for the
+// other methods, calls without the metadata, or if store is nil.
+func grpcIdempotent(ctx context.Context, store *IdempotencyStore, method string, req interface{}, call func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	key := incomingMetadata(ctx, GrpcIdempotencyKeyMetadata)
+	if store == nil || key == "" || !isWriteOperation(grpcOperation(method)) {
+		return call(ctx)
+	}
+	if len(key) > MaxIdempotencyKeyLen {
+		return nil, NewValidationError(GrpcIdempotencyKeyMetadata, []Violation{{GrpcIdempotencyKeyMetadata, fmt.Sprintf("must be at most %v characters long", MaxIdempotencyKeyLen)}})
+	}
+
+	fingerprint, err := proto.MarshalOptions{Deterministic: true}.Marshal(req.(proto.Message))
+	if err != nil {
+		return nil, NewError(ERROR_INTERNAL, "[grpcIdempotent] proto.Marshal failed. error=%v", err)
+	}
+	key = fmt.Sprintf("%v|%v|%v", appFromContext(ctx).Name, method, key)
+	stored, err := store.Begin(key, string(fingerprint))
+	if err != nil {
+		return nil, err
+	}
+	if stored != nil {
+		grpc.SetHeader(ctx, metadata.Pairs(GrpcIdempotentReplayedMetadata, strconv.FormatBool(true)))
+		if stored.Status != http.StatusOK {
+			var e FollowerError
+			json.Unmarshal(stored.Body, &e)
+			return nil, e
+		}
+		return replayedMessage(stored)
+	}
+
+	// a panic, or a response which cannot be stored, leaves the outcome unknown.
+	finished := false
+	defer func() {
+		if !finished {
+			store.Abandon(key)
+		}
+	}()
+
+	resp, err := call(ctx)
+	status, contentType, body := http.StatusOK, "", []byte(nil)
+	if err != nil {
+		e, ok := err.(FollowerError)
+		if !ok {
+			e = NewError(ERROR_INTERNAL, "unexpected error. error=%v", err).(FollowerError)
+		}
+		status, contentType, err = httpStatus(e.Code), "application/json", e
+		body, _ = json.Marshal(e)
+	} else {
+		message := resp.(proto.Message)
+		if body, err = proto.Marshal(message); err != nil {
+			return nil, NewError(ERROR_INTERNAL, "[grpcIdempotent] proto.Marshal failed. error=%v", err)
+		}
+		contentType = string(proto.MessageName(message))
+	}
+
+	store.Finish(key, status, contentType, body)
+	finished = true
+	return resp, err
+}
+
+// replayedMessage decodes the response stored by grpcIdempotent, whose content type is the
+// full name of its message.
+func replayedMessage(stored *IdempotentResponse) (proto.Message, error) {
+	messageType, err := protoregistry.GlobalTypes.FindMessageByName(protoreflect.FullName(stored.ContentType))
+	if err != nil {
+		return nil, NewError(ERROR_INTERNAL, "[grpcIdempotent] unknown message. message=%v error=%v", stored.ContentType, err)
+	}
+
+	message := messageType.New().Interface()
+	if err := proto.Unmarshal(stored.Body, message); err != nil {
+		return nil, NewError(ERROR_INTERNAL, "[grpcIdempotent] proto.Unmarshal failed. error=%v", err)
+	}
+
+	return message, nil
+}
+
+func grpcUnaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx, err := grpcContext(ctx, info.FullMethod)
+
+	var resp interface{}
+	if err == nil {
+		resp, err = grpcGuard(ctx, info.FullMethod, req, func(ctx context.Context) (interface{}, error) {
+			ctx, cancel := context.WithTimeout(ctx, currentConfig().RequestTimeout)
+			defer cancel()
+
+			return handler(ctx, req)
+		})
+	}
+
+	err, trailer := grpcStatus(ctx, err)
+	if trailer != nil {
+		grpc.SetTrailer(ctx, trailer)
+	}
+	return resp, err
+}
+
+// grpcStream carries the context of grpcContext.
+type grpcStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (p *grpcStream) Context() context.Context {
+	return p.ctx
+}
+
+func grpcStreamInterceptor(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := grpcContext(stream.Context(), info.FullMethod)
+	if err == nil {
+		_, err = grpcGuard(ctx, info.FullMethod, nil, func(ctx context.Context) (interface{}, error) {
+			return nil, handler(srv, &grpcStream{stream, ctx})
+		})
+	}
+
+	err, trailer := grpcStatus(ctx, err)
+	if trailer != nil {
+		stream.SetTrailer(trailer)
+	}
+	return err
+}
+
+func newGrpcServer(options ...grpc.ServerOption) *grpc.Server {
+	options = append(options,
+		grpc.ChainUnaryInterceptor(grpcUnaryInterceptor),
+		grpc.ChainStreamInterceptor(grpcStreamInterceptor))
+
+	server := grpc.NewServer(options...)
+	followerpb.RegisterFollowerServer(server, &FollowerServer{})
+	return server
+}
+
+// startGrpc serves the grpc service on grpc_addr, with the certificate of the client listener
+// if tls is set. It does nothing if grpc_addr is empty.
+func startGrpc() {
+	if gobalConfig.GrpcAddr == "" {
+		return
+	}
+
+	var options []grpc.ServerOption
+	if gobalConfig.TLS {
+		options = append(options, grpc.Creds(credentials.NewTLS(newTLSConfig(false))))
+	}
+	gobalGrpcServer = newGrpcServer(options...)
+
+	listener, err := net.Listen("tcp", gobalConfig.GrpcAddr)
+	if err != nil {
+		log.Errorf("[startGrpc] listen failed. addr=%v error=%v", gobalConfig.GrpcAddr, err)
+		os.Exit(1)
+	}
+
+	log.Infof("start grpc server. addr=%v tls=%v", gobalConfig.GrpcAddr, gobalConfig.TLS)
+
+	go func() {
+		if err := gobalGrpcServer.Serve(listener); err != nil {
+			log.Errorf("[startGrpc] grpc server failed. error=%v", err)
+			os.Exit(1)
+		}
+	}()
+}
+
+// stopGrpc waits for the running calls until ctx is done, then cancels them.
+func stopGrpc(ctx context.Context) error {
+	if gobalGrpcServer == nil {
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		gobalGrpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		gobalGrpcServer.Stop()
+		return ctx.Err()
+	}
+}
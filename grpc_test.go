@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go-web/followerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	. "gopkg.in/check.v1"
+	"net"
+	"net/http"
+	"time"
+)
+
+var _ = Suite(&GrpcSuite{})
+
+type GrpcSuite struct {
+	server *grpc.Server
+	conn   *grpc.ClientConn
+	client followerpb.FollowerClient
+}
+
+func (p *GrpcSuite) SetUpTest(c *C) {
+	gobalConfig.UserIdLen = DefaultUserIdLen
+	gobalConfig.RequestTimeout = DefaultRequestTimeout
+	gobalApps = NewAppRegistry(Config{})
+
+	listener := bufconn.Listen(1 << 20)
+	p.server = newGrpcServer()
+	go p.server.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	c.Assert(err, IsNil)
+	p.conn = conn
+	p.client = followerpb.NewFollowerClient(conn)
+}
+
+func (p *GrpcSuite) TearDownTest(c *C) {
+	p.conn.Close()
+	p.server.Stop()
+	gobalMaintenance.Set(MaintenanceState{})
+	gobalConfig.RateLimit = RateLimitConfig{}
+	gobalRateLimiter = NewRateLimiter(time.Now)
+}
+
+// trailerCode returns the grpc code of err and the error code on the trailer.
+func trailerCode(err error, trailer metadata.MD) (codes.Code, string) {
+	code := ""
+	if values := trailer.Get(GrpcErrorCodeMetadata); len(values) != 0 {
+		code = values[0]
+	}
+	return status.Code(err), code
+}
+
+// info calls Info and returns the grpc code and the error code on the trailer.
+func (p *GrpcSuite) info(ctx context.Context, userId string) (codes.Code, string) {
+	var trailer metadata.MD
+	_, err := p.client.Info(ctx, &followerpb.UserRequest{UserId: userId}, grpc.Trailer(&trailer))
+	return trailerCode(err, trailer)
+}
+
+// buyFollower calls BuyFollower and returns the grpc code and the error code on the trailer.
+func (p *GrpcSuite) buyFollower(req *followerpb.BuyFollowerRequest) (codes.Code, string) {
+	var trailer metadata.MD
+	_, err := p.client.BuyFollower(context.Background(), req, grpc.Trailer(&trailer))
+	return trailerCode(err, trailer)
+}
+
+// watch starts WatchProgress with req, and returns the error of its first message.
+func (p *GrpcSuite) watch(req *followerpb.WatchProgressRequest) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := p.client.WatchProgress(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	_, err = stream.Recv()
+	return err
+}
+
+func (p *GrpcSuite) Test_invalidRequest(c *C) {
+	var trailer metadata.MD
+	_, err := p.client.Progress(context.Background(), &followerpb.UserRequest{UserId: "1"}, grpc.Trailer(&trailer))
+	code, errorCode := trailerCode(err, trailer)
+
+	c.Assert(code, Equals, codes.InvalidArgument)
+	c.Assert(errorCode, Equals, fmt.Sprintf("%v", ERROR_URL_PARAM_INVALID))
+}
+
+func (p *GrpcSuite) Test_missingParam(c *C) {
+	var trailer metadata.MD
+	_, err := p.client.Coins(context.Background(), &followerpb.CoinsRequest{UserId: "000000001"}, grpc.Trailer(&trailer))
+	code, errorCode := trailerCode(err, trailer)
+
+	c.Assert(code, Equals, codes.InvalidArgument)
+	c.Assert(errorCode, Equals, fmt.Sprintf("%v", ERROR_URL_PARAM_INVALID))
+}
+
+func (p *GrpcSuite) Test_grpcRequest(c *C) {
+	var coins CoinsRequestV2
+	err := grpcRequest(&followerpb.CoinsRequest{UserId: "000000001"}, &coins)
+	c.Assert(err.(FollowerError).Violations, DeepEquals, []Violation{{"coins", "is required"}})
+
+	// an optional 0 is present.
+	c.Assert(grpcRequest(&followerpb.CoinsRequest{UserId: "000000001", Coins: proto.Int64(0)}, &coins), IsNil)
+	c.Assert(coins, Equals, CoinsRequestV2{UserId: "000000001"})
+
+	var buy BuyFollowerRequestV2
+	err = grpcRequest(&followerpb.BuyFollowerRequest{UserId: "1", Coins: proto.Int64(0), Value: proto.Int64(2)}, &buy)
+	c.Assert(err.(FollowerError).Violations, DeepEquals, []Violation{
+		{"userId", "must be 9 characters long"},
+		{"coins", "must be at least 1"},
+	})
+
+	var watch WatchProgressRequest
+	c.Assert(grpcRequest(&followerpb.WatchProgressRequest{UserId: "000000001", IntervalMs: 500}, &watch), IsNil)
+	c.Assert(watch, Equals, WatchProgressRequest{UserId: "000000001", IntervalMs: 500})
+
+	var user UserRequestV2
+	err = grpcRequest(&followerpb.UserRequest{}, &user)
+	c.Assert(err.(FollowerError).Violations, DeepEquals, []Violation{{"userId", "is required"}})
+}
+
+func (p *GrpcSuite) Test_unknownApp(c *C) {
+	ctx := metadata.AppendToOutgoingContext(context.Background(), GrpcAppMetadata, "nope")
+	code, errorCode := p.info(ctx, "000000001")
+
+	c.Assert(code, Equals, codes.NotFound)
+	c.Assert(errorCode, Equals, fmt.Sprintf("%v", ERROR_APP_NOT_FOUND))
+}
+
+func (p *GrpcSuite) Test_otherAppOnAuthority(c *C) {
+	gobalApps = NewAppRegistry(Config{Apps: []AppConfig{
+		{Name: "likes", Hosts: []string{"bufnet"}, DbName: "likes"},
+		{Name: "views", DbName: "views"},
+	}})
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), GrpcAppMetadata, "views")
+	code, errorCode := p.info(ctx, "000000001")
+
+	c.Assert(code, Equals, codes.NotFound)
+	c.Assert(errorCode, Equals, fmt.Sprintf("%v", ERROR_APP_NOT_FOUND))
+}
+
+func (p *GrpcSuite) Test_maintenance(c *C) {
+	gobalMaintenance.Set(MaintenanceState{Enabled: true, Message: "migrating"})
+	code, errorCode := p.buyFollower(&followerpb.BuyFollowerRequest{UserId: "000000001", Coins: proto.Int64(1), Value: proto.Int64(1)})
+
+	c.Assert(code, Equals, codes.Unavailable)
+	c.Assert(errorCode, Equals, fmt.Sprintf("%v", ERROR_MAINTENANCE))
+}
+
+func (p *GrpcSuite) Test_maintenance_watch(c *C) {
+	gobalMaintenance.Set(MaintenanceState{Enabled: true, Routes: []string{"/v2/progress"}})
+
+	err := p.watch(&followerpb.WatchProgressRequest{UserId: "000000001"})
+	c.Assert(status.Code(err), Equals, codes.Unavailable)
+}
+
+func (p *GrpcSuite) Test_rateLimited(c *C) {
+	gobalConfig.RateLimit = RateLimitConfig{PerUser: 0.01, PerUserBurst: 1}
+	gobalRateLimiter = NewRateLimiter(time.Now)
+
+	// invalid, so that the first call is answered without mongodb.
+	req := &followerpb.BuyFollowerRequest{UserId: "000000001", Coins: proto.Int64(1)}
+	code, _ := p.buyFollower(req)
+	c.Assert(code, Equals, codes.InvalidArgument)
+
+	var header metadata.MD
+	_, err := p.client.BuyFollower(context.Background(), req, grpc.Header(&header))
+	c.Assert(status.Code(err), Equals, codes.ResourceExhausted)
+	c.Assert(header.Get(GrpcRetryAfterMetadata), DeepEquals, []string{"100"})
+
+	code, _ = p.buyFollower(&followerpb.BuyFollowerRequest{UserId: "000000002", Coins: proto.Int64(1)})
+	c.Assert(code, Equals, codes.InvalidArgument)
+}
+
+func (p *GrpcSuite) Test_maxWatches(c *C) {
+	gobalConfig.GrpcMaxWatches = 1
+	defer func() { gobalConfig.GrpcMaxWatches = 0 }()
+	c.Assert(gobalWatches.Acquire(1), Equals, true)
+	defer gobalWatches.Release()
+
+	err := p.watch(&followerpb.WatchProgressRequest{UserId: "000000001"})
+	c.Assert(status.Code(err), Equals, codes.Unavailable)
+	c.Assert(gobalWatches.Running(), Equals, int64(1))
+}
+
+func (p *GrpcSuite) Test_Watches(c *C) {
+	var watches Watches
+	c.Assert(watches.Acquire(2), Equals, true)
+	c.Assert(watches.Acquire(2), Equals, true)
+	c.Assert(watches.Acquire(2), Equals, false)
+	watches.Release()
+	c.Assert(watches.Acquire(0), Equals, true)
+	c.Assert(watches.Running(), Equals, int64(2))
+	c.Assert(watches.Total(), Equals, int64(3))
+}
+
+func (p *GrpcSuite) Test_grpcOperation(c *C) {
+	c.Assert(grpcOperation("/follower.Follower/BuyFollower"), Equals, "buyfollower")
+	c.Assert(grpcOperation("/follower.Follower/WatchProgress"), Equals, "progress")
+	for _, method := range followerpb.Follower_ServiceDesc.Methods {
+		c.Assert(isClientOperation(grpcOperation(method.MethodName)), Equals, true, Commentf("method %v", method.MethodName))
+	}
+}
+
+func (p *GrpcSuite) Test_grpcIdempotent(c *C) {
+	store := NewIdempotencyStore(time.Hour, 10, time.Now)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(GrpcIdempotencyKeyMetadata, "k1"))
+	method := fmt.Sprintf("/%v/BuyFollower", GrpcServiceName)
+	req := &followerpb.BuyFollowerRequest{UserId: "000000001", Coins: proto.Int64(10), Value: proto.Int64(1)}
+
+	calls := 0
+	call := func(err error) func(ctx context.Context) (interface{}, error) {
+		return func(ctx context.Context) (interface{}, error) {
+			calls++
+			if err != nil {
+				return nil, err
+			}
+			return &followerpb.BuyFollowerResponse{Coins: 90}, nil
+		}
+	}
+
+	resp, err := grpcIdempotent(ctx, store, method, req, call(nil))
+	c.Assert(err, IsNil)
+	c.Assert(resp.(*followerpb.BuyFollowerResponse).Coins, Equals, int64(90))
+	resp, err = grpcIdempotent(ctx, store, method, req, call(nil))
+	c.Assert(err, IsNil)
+	c.Assert(resp.(*followerpb.BuyFollowerResponse).Coins, Equals, int64(90))
+	c.Assert(calls, Equals, 1)
+
+	_, err = grpcIdempotent(ctx, store, method, &followerpb.BuyFollowerRequest{UserId: "000000001", Coins: proto.Int64(20), Value: proto.Int64(2)}, call(nil))
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_IDEMPOTENCY_KEY_REUSED)
+
+	// a timeout may have written, and is replayed. DB_UNAVAILABLE has not, and is retried.
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(GrpcIdempotencyKeyMetadata, "k2"))
+	calls = 0
+	for i := 0; i < 2; i++ {
+		_, err = grpcIdempotent(ctx, store, method, req, call(NewError(ERROR_TIMEOUT, "timeout")))
+		c.Assert(err.(FollowerError).Code, Equals, ERROR_TIMEOUT)
+	}
+	c.Assert(calls, Equals, 1)
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(GrpcIdempotencyKeyMetadata, "k3"))
+	calls = 0
+	for i := 0; i < 2; i++ {
+		_, err = grpcIdempotent(ctx, store, method, req, call(NewError(ERROR_DB_UNAVAILABLE, "down")))
+		c.Assert(err.(FollowerError).Code, Equals, ERROR_DB_UNAVAILABLE)
+	}
+	c.Assert(calls, Equals, 2)
+
+	// reads are not kept.
+	calls = 0
+	for i := 0; i < 2; i++ {
+		grpcIdempotent(ctx, store, fmt.Sprintf("/%v/Info", GrpcServiceName), &followerpb.UserRequest{UserId: "000000001"}, call(nil))
+	}
+	c.Assert(calls, Equals, 2)
+}
+
+func (p *GrpcSuite) Test_WatchProgress_invalidRequest(c *C) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := p.client.WatchProgress(ctx, &followerpb.WatchProgressRequest{UserId: "000000001", IntervalMs: 1})
+	c.Assert(err, IsNil)
+
+	_, err = stream.Recv()
+	c.Assert(status.Code(err), Equals, codes.InvalidArgument)
+	c.Assert(stream.Trailer().Get(GrpcErrorNameMetadata), DeepEquals, []string{"URL_PARAM_INVALID"})
+}
+
+func (p *GrpcSuite) Test_grpcCode(c *C) {
+	for _, entry := range errorCatalog {
+		if entry.Status != http.StatusInternalServerError {
+			c.Assert(grpcCode(entry.Status), Not(Equals), codes.Internal, Commentf("error %v", entry.Name))
+		}
+	}
+}
+
+func (p *GrpcSuite) Test_progressComplete(c *C) {
+	c.Assert(progressComplete(ProgressResponse{UserId: "000000001"}), Equals, false)
+	c.Assert(progressComplete(ProgressResponse{Orders: []OrderProgress{{Status: true}, {Status: false}}}), Equals, false)
+	c.Assert(progressComplete(ProgressResponse{Orders: []OrderProgress{{Status: true}}}), Equals, true)
+}
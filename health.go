@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"time"
+)
+
+const HealthCheckTimeout = 2 * time.Second
+
+// CheckResult is the result of a readiness check. An informational check is reported but
+// does not fail the readiness.
+type CheckResult struct {
+	Ok            bool   `json:"ok"`
+	Error         string `json:"error,omitempty"`
+	LatencyMs     int64  `json:"latencyMs,omitempty"`
+	State         string `json:"state,omitempty"`
+	Informational bool   `json:"informational,omitempty"`
+}
+
+type HealthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// healthzHandler reports that the process is alive.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	writeHealthStatus(w, http.StatusOK, HealthStatus{Status: "ok"})
+}
+
+// readyzHandler reports whether the server can take client traffic: mongodb answers a
+// ping, its circuit breaker is not open, the pending orders are loaded into the PushManager
+// and the server is not draining. With user_cache_size, the server still serves the cached
+// reads while mongodb is down, so the mongodb checks are informational: a failure reports
+// the status degraded, instead of taking every instance out of the load balancer at once.
+func readyzHandler(w http.ResponseWriter, r *http.Request) {
+	degradable := currentConfig().UserCacheSize > 0
+	mongo, breaker := checkMongo(), checkBreaker(gobalDbBreaker)
+	mongo.Informational, breaker.Informational = degradable, degradable
+
+	checks := map[string]CheckResult{
+		"mongo":        mongo,
+		"mongoBreaker": breaker,
+		"pushManager":  checkCondition(allOrdersLoaded(), "user orders are still loading"),
+		"draining":     checkCondition(!isDraining(), "server is shutting down"),
+	}
+
+	status := HealthStatus{Status: "ok", Checks: checks}
+	code := http.StatusOK
+	for _, check := range checks {
+		if check.Ok {
+			continue
+		}
+		if !check.Informational {
+			status.Status = "fail"
+			code = http.StatusServiceUnavailable
+			break
+		}
+		status.Status = "degraded"
+	}
+
+	writeHealthStatus(w, code, status)
+}
+
+// checkMongo pings mongodb when the circuit breaker allows it. The ping also serves as a
+// probe of the breaker, so that it closes again even when no client traffic reaches an
+// unready server. An open breaker is reported without a ping.
+func checkMongo() CheckResult {
+	if !gobalDbBreaker.Allow() {
+		state := gobalDbBreaker.State()
+		return CheckResult{State: state.String(), Error: fmt.Sprintf("mongodb circuit breaker is %v, ping skipped", state)}
+	}
+
+	if gobalMgoSession == nil {
+		return CheckResult{Error: "mongodb is not connected"}
+	}
+
+	session := gobalMgoSession.Copy()
+	defer session.Close()
+	session.SetSyncTimeout(HealthCheckTimeout)
+	session.SetSocketTimeout(HealthCheckTimeout)
+
+	start := time.Now()
+	err := session.Ping()
+	gobalDbBreaker.Record(err)
+	result := CheckResult{Ok: err == nil, LatencyMs: time.Since(start).Nanoseconds() / int64(time.Millisecond)}
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+func checkBreaker(breaker *CircuitBreaker) CheckResult {
+	state := breaker.State()
+	result := CheckResult{Ok: state != BreakerOpen, State: state.String()}
+	if !result.Ok {
+		result.Error = "mongodb circuit breaker is open"
+	}
+
+	return result
+}
+
+func allOrdersLoaded() bool {
+	for _, app := range gobalApps.All() {
+		if !app.PushManager.Loaded() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func checkCondition(ok bool, reason string) CheckResult {
+	if ok {
+		return CheckResult{Ok: true}
+	}
+
+	return CheckResult{Error: reason}
+}
+
+func writeHealthStatus(w http.ResponseWriter, code int, status HealthStatus) {
+	bStatus, err := json.Marshal(status)
+	if err != nil {
+		log.Errorf("[writeHealthStatus] json.Marshal failed. error=%v", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(bStatus)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"time"
+)
+
+var _ = Suite(&HealthSuite{})
+
+type HealthSuite struct{}
+
+func (p *HealthSuite) SetUpTest(c *C) {
+	gobalApps = NewAppRegistry(Config{})
+	gobalApps.Default().PushManager.SetLoaded()
+	gobalConfig.UserCacheSize = 0
+}
+
+func (p *HealthSuite) TearDownTest(c *C) {
+	atomic.StoreInt32(&gobalDraining, 0)
+	gobalConfig.UserCacheSize = 0
+}
+
+// readyz returns the status code and the body of /readyz. mongodb is not connected.
+func (p *HealthSuite) readyz(c *C) (int, HealthStatus) {
+	w := httptest.NewRecorder()
+	readyzHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+
+	var status HealthStatus
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &status), IsNil)
+	return w.Code, status
+}
+
+func (p *HealthSuite) Test_readyz_mongoDown(c *C) {
+	code, status := p.readyz(c)
+
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(status.Status, Equals, "fail")
+	c.Assert(status.Checks["mongo"], Equals, CheckResult{Error: "mongodb is not connected"})
+}
+
+func (p *HealthSuite) Test_readyz_degraded(c *C) {
+	gobalConfig.UserCacheSize = 10
+	code, status := p.readyz(c)
+
+	c.Assert(code, Equals, http.StatusOK)
+	c.Assert(status.Status, Equals, "degraded")
+	c.Assert(status.Checks["mongo"], Equals, CheckResult{Error: "mongodb is not connected", Informational: true})
+	c.Assert(status.Checks["mongoBreaker"].Informational, Equals, true)
+	c.Assert(status.Checks["pushManager"], Equals, CheckResult{Ok: true})
+
+	atomic.StoreInt32(&gobalDraining, 1)
+	code, status = p.readyz(c)
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(status.Status, Equals, "fail")
+}
+
+func (p *HealthSuite) Test_healthz(c *C) {
+	w := httptest.NewRecorder()
+	healthzHandler(w, httptest.NewRequest("GET", "/healthz", nil))
+
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(w.Header().Get("Content-Type"), Equals, "application/json")
+	c.Assert(w.Body.String(), Equals, `{"status":"ok"}`)
+}
+
+func (p *HealthSuite) Test_readyz_loading(c *C) {
+	gobalConfig.UserCacheSize = 10
+	gobalApps = NewAppRegistry(Config{Apps: []AppConfig{{Name: "likes", DbName: "likes"}}})
+	gobalApps.Default().PushManager.SetLoaded()
+	code, status := p.readyz(c)
+
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(status.Status, Equals, "fail")
+	c.Assert(status.Checks["pushManager"], Equals, CheckResult{Error: "user orders are still loading"})
+	c.Assert(status.Checks["draining"], Equals, CheckResult{Ok: true})
+}
+
+func (p *HealthSuite) Test_readyz_draining(c *C) {
+	gobalConfig.UserCacheSize = 10
+	atomic.StoreInt32(&gobalDraining, 1)
+	code, status := p.readyz(c)
+
+	c.Assert(code, Equals, http.StatusServiceUnavailable)
+	c.Assert(status.Checks["draining"], Equals, CheckResult{Error: "server is shutting down"})
+}
+
+func (p *HealthSuite) Test_checkBreaker(c *C) {
+	breaker := NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, time.Now)
+	c.Assert(checkBreaker(breaker), Equals, CheckResult{Ok: true, State: BreakerClosed.String()})
+
+	breaker.Record(errors.New("no reachable servers"))
+	c.Assert(checkBreaker(breaker), Equals, CheckResult{State: BreakerOpen.String(), Error: "mongodb circuit breaker is open"})
+}
+
+func (p *HealthSuite) Test_checkMongo_breakerOpen(c *C) {
+	defer func(breaker *CircuitBreaker) { gobalDbBreaker = breaker }(gobalDbBreaker)
+	gobalDbBreaker = NewCircuitBreaker(BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, time.Now)
+	gobalDbBreaker.Record(errors.New("no reachable servers"))
+
+	c.Assert(checkMongo(), Equals, CheckResult{State: BreakerOpen.String(), Error: "mongodb circuit breaker is open, ping skipped"})
+	c.Assert(gobalDbBreaker.State(), Equals, BreakerOpen)
+	c.Assert(gobalDbBreaker.Trips(), Equals, int64(1))
+}
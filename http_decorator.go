@@ -1,27 +1,67 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
-	log "github.com/sirupsen/logrus"
 	"net/http"
+	"runtime/debug"
 	"time"
 )
 
+// MaxRecordedBodyBytes bounds the response body kept by bodyRecorder.
+const MaxRecordedBodyBytes = 1 << 20
+
 type Decorator func(http.HandlerFunc) http.HandlerFunc
 
-func loggingAndRespError() Decorator {
+// HandlerFunc is a handler which returns its failure instead of writing it. Adapt it to
+// http.HandlerFunc with handle.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// handle writes the error returned by fn with writeError.
+func handle(fn HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := fn(w, r); err != nil {
+			writeError(w, r, err)
+		}
+	}
+}
+
+// writeError logs the detail of err and answers its client message in the language of the
+// request, as problem+json if the client accepts it. Errors other than FollowerError are answered as ERROR_INTERNAL.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	e, ok := err.(FollowerError)
+	if !ok {
+		e = NewError(ERROR_INTERNAL, "unexpected error. error=%v", err).(FollowerError)
+	}
+	requestLogger(r.Context()).WithField("errorCode", fmt.Sprintf("0x%x", e.Code)).Error(e.Error())
+
+	lang := requestLang(r)
+	e = localize(e, lang)
+	w.Header().Set("Content-Language", lang)
+
+	if wantsProblem(r) {
+		writeProblem(w, r, e)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus(e.Code))
+	responseError(w, e)
+}
+
+// recovering turns a panic of fn into a 500 ERROR_INTERNAL response, logging its stack,
+// instead of dropping the connection.
+func recovering() Decorator {
 	return func(fn http.HandlerFunc) http.HandlerFunc {
 		return func(w http.ResponseWriter, r *http.Request) {
 			defer func() {
-				if err, ok := recover().(error); ok {
-					e, ok := err.(FollowerError)
-					if ok {
-						w.WriteHeader(400)
-						log.Error(fmt.Sprintf("%v. errorCode=0x%x", e.Error(), e.Code))
-						responseError(w, e)
-					} else {
-						panic(err)
+				if v := recover(); v != nil {
+					if v == http.ErrAbortHandler {
+						panic(v)
 					}
+
+					requestLogger(r.Context()).WithField("stack", string(debug.Stack())).Errorf("panic serving %v. panic=%v", r.URL.Path, v)
+					writeError(w, r, NewError(ERROR_INTERNAL, "[recovering] panic. panic=%v", v))
 				}
 			}()
 
@@ -52,3 +92,32 @@ func Decorate(fn http.HandlerFunc, ds ...Decorator) http.HandlerFunc {
 
 	return decorated
 }
+
+// bodyRecorder keeps a copy of the response body up to MaxRecordedBodyBytes, and sets
+// overflow if it is longer.
+type bodyRecorder struct {
+	http.ResponseWriter
+	status   int
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (p *bodyRecorder) WriteHeader(code int) {
+	if p.status == 0 {
+		p.status = code
+	}
+	p.ResponseWriter.WriteHeader(code)
+}
+
+func (p *bodyRecorder) Write(b []byte) (int, error) {
+	if p.status == 0 {
+		p.status = http.StatusOK
+	}
+	if p.body.Len()+len(b) > MaxRecordedBodyBytes {
+		p.overflow = true
+	} else {
+		p.body.Write(b)
+	}
+
+	return p.ResponseWriter.Write(b)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Suite(&DecoratorSuite{})
+
+type DecoratorSuite struct{}
+
+func (p *DecoratorSuite) serve(c *C, fn http.HandlerFunc) (int, FollowerError) {
+	w := httptest.NewRecorder()
+	fn(w, httptest.NewRequest("GET", "/getfollowers/info", nil))
+
+	var e FollowerError
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &e), IsNil)
+	return w.Code, e
+}
+
+func (p *DecoratorSuite) Test_handle_followerError(c *C) {
+	code, e := p.serve(c, handle(func(w http.ResponseWriter, r *http.Request) error {
+		return NewError(ERROR_USER_NOT_FOUND, "[test] user not found")
+	}))
+
+	c.Assert(code, Equals, http.StatusNotFound)
+	c.Assert(e, DeepEquals, FollowerError{Code: ERROR_USER_NOT_FOUND, Name: "USER_NOT_FOUND", Msg: "user not found"})
+}
+
+func (p *DecoratorSuite) Test_handle_unexpectedError(c *C) {
+	code, e := p.serve(c, handle(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("secret detail")
+	}))
+
+	c.Assert(code, Equals, http.StatusInternalServerError)
+	c.Assert(e, DeepEquals, FollowerError{Code: ERROR_INTERNAL, Name: "INTERNAL", Msg: "internal error"})
+}
+
+func (p *DecoratorSuite) Test_recovering(c *C) {
+	code, e := p.serve(c, Decorate(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	}, recovering()))
+
+	c.Assert(code, Equals, http.StatusInternalServerError)
+	c.Assert(e.Code, Equals, ERROR_INTERNAL)
+}
+
+func (p *DecoratorSuite) Test_writeError_problem(c *C) {
+	r := httptest.NewRequest("GET", "/getfollowers/info", nil)
+	r.Header.Set("Accept", "application/json, application/problem+json;q=0.9")
+	w := httptest.NewRecorder()
+	writeError(w, r, NewError(ERROR_DB_OPERATE_FAIELD, "[queryInfo] query.one failed. error=no reachable servers"))
+
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(w.Header().Get("Content-Type"), Equals, ProblemContentType)
+
+	var problem Problem
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &problem), IsNil)
+	c.Assert(problem.Status, Equals, http.StatusServiceUnavailable)
+	c.Assert(problem.Code, Equals, ERROR_DB_OPERATE_FAIELD)
+	c.Assert(problem.Instance, Equals, "/getfollowers/info")
+	c.Assert(problem.Detail, Equals, "database operation failed, please retry later")
+	c.Assert(problem.Type, Equals, "urn:follower:error:DB_OPERATE_FAILED")
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"container/list"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	IdempotencyKeyHeader      = "Idempotency-Key"
+	IdempotentReplayedHeader  = "Idempotent-Replayed"
+	MaxIdempotencyKeyLen      = 255
+	IdempotencyCleanInterval  = time.Minute
+	DefaultIdempotencyTTL     = 24 * time.Hour
+	DefaultIdempotencyMaxKeys = 100000
+	idempotencyStatusReserved = 0
+)
+
+// IdempotencyStore remembers the responses of the write routes by their Idempotency-Key for
+// ttl, so that a retried request is answered with the first response instead of being
+// applied twice. It is kept in memory, so a retry must reach the same process. It keeps at
+// most capacity keys, dropping the least recently used.
+type IdempotencyStore struct {
+	mutex     sync.Mutex
+	capacity  int
+	entries   map[string]*list.Element
+	order     *list.List
+	ttl       time.Duration
+	now       func() time.Time
+	replays   int64
+	evictions int64
+}
+
+// IdempotentResponse is a stored response, or a reservation while its status is 0. Unknown
+// marks a request which failed without a response to replay, and may have been applied.
+type IdempotentResponse struct {
+	Fingerprint string
+	Status      int
+	ContentType string
+	Body        []byte
+	Expires     time.Time
+	Unknown     bool
+	key         string
+}
+
+var gobalIdempotencyStore *IdempotencyStore
+
+func NewIdempotencyStore(ttl time.Duration, capacity int, now func() time.Time) *IdempotencyStore {
+	return &IdempotencyStore{capacity: capacity, entries: make(map[string]*list.Element), order: list.New(), ttl: ttl, now: now}
+}
+
+func initIdempotency() {
+	if gobalConfig.IdempotencyTTL <= 0 {
+		return
+	}
+
+	gobalIdempotencyStore = NewIdempotencyStore(gobalConfig.IdempotencyTTL, gobalConfig.IdempotencyMaxKeys, time.Now)
+	go func() {
+		for range time.Tick(IdempotencyCleanInterval) {
+			gobalIdempotencyStore.Clean()
+		}
+	}()
+}
+
+// Begin reserves key for a request with fingerprint, and returns nil. If key is already
+// used it returns the stored response, or ERROR_IDEMPOTENCY_IN_PROGRESS while the first
+// request runs, or ERROR_IDEMPOTENCY_UNKNOWN if it failed without a response, or
+// ERROR_IDEMPOTENCY_KEY_REUSED if the fingerprints differ.
+func (p *IdempotencyStore) Begin(key string, fingerprint string) (*IdempotentResponse, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	element, ok := p.entries[key]
+	if !ok || now.After(element.Value.(*IdempotentResponse).Expires) {
+		if ok {
+			p.remove(element)
+		}
+		p.entries[key] = p.order.PushFront(&IdempotentResponse{Fingerprint: fingerprint, Expires: now.Add(p.ttl), key: key})
+		for p.order.Len() > p.capacity {
+			p.remove(p.order.Back())
+			atomic.AddInt64(&p.evictions, 1)
+		}
+		return nil, nil
+	}
+	p.order.MoveToFront(element)
+
+	entry := element.Value.(*IdempotentResponse)
+	if entry.Fingerprint != fingerprint {
+		return nil, NewError(ERROR_IDEMPOTENCY_KEY_REUSED, "[IdempotencyStore.Begin] key used by another request. key=%v", key)
+	}
+	if entry.Unknown {
+		return nil, NewError(ERROR_IDEMPOTENCY_UNKNOWN, "[IdempotencyStore.Begin] first request failed and may have been applied. key=%v", key)
+	}
+	if entry.Status == idempotencyStatusReserved {
+		return nil, NewError(ERROR_IDEMPOTENCY_IN_PROGRESS, "[IdempotencyStore.Begin] first request still running. key=%v", key)
+	}
+
+	atomic.AddInt64(&p.replays, 1)
+	return entry, nil
+}
+
+// Finish stores the response of the request reserving key. The errors raised before the
+// write, see notApplied, are forgotten so that the retry is applied. Other server errors,
+// such as a timeout after the write reached mongodb, are stored like any response.
+func (p *IdempotencyStore) Finish(key string, status int, contentType string, body []byte) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	element, ok := p.entries[key]
+	if !ok {
+		return
+	}
+	if status >= http.StatusInternalServerError && notApplied(body) {
+		p.remove(element)
+		return
+	}
+
+	entry := element.Value.(*IdempotentResponse)
+	entry.Status, entry.ContentType, entry.Body = status, contentType, body
+}
+
+// Abandon marks the request reserving key as failed without a response to replay, e.g. on
+// a panic. Its retries are answered with ERROR_IDEMPOTENCY_UNKNOWN.
+func (p *IdempotencyStore) Abandon(key string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if element, ok := p.entries[key]; ok {
+		element.Value.(*IdempotentResponse).Unknown = true
+	}
+}
+
+func (p *IdempotencyStore) Clean() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	for _, element := range p.entries {
+		if now.After(element.Value.(*IdempotentResponse).Expires) {
+			p.remove(element)
+		}
+	}
+}
+
+func (p *IdempotencyStore) remove(element *list.Element) {
+	delete(p.entries, p.order.Remove(element).(*IdempotentResponse).key)
+}
+
+func (p *IdempotencyStore) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.entries)
+}
+
+func (p *IdempotencyStore) Replays() int64 {
+	return atomic.LoadInt64(&p.replays)
+}
+
+// Evictions counts the keys dropped before their ttl as the store was full.
+func (p *IdempotencyStore) Evictions() int64 {
+	return atomic.LoadInt64(&p.evictions)
+}
+
+// notApplied reports whether the error response body has the code of an error raised before
+// the request could write, so that its retry is safe.
+func notApplied(body []byte) bool {
+	var e struct {
+		Code int `json:"code"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil {
+		return false
+	}
+
+	switch e.Code {
+	case ERROR_DB_UNAVAILABLE, ERROR_READ_ONLY, ERROR_MAINTENANCE, ERROR_SERVER_BUSY, ERROR_RATE_LIMITED:
+		return true
+	}
+
+	return false
+}
+
+// idempotent answers a request of a write route repeating the Idempotency-Key of an earlier
+// one with the earlier response, marked with the Idempotent-Replayed header. It does nothing
+// for the other routes, requests without the header, or if store is nil.
+func idempotent(store *IdempotencyStore, route Route) Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		if store == nil || !route.Write {
+			return fn
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				fn(w, r)
+				return
+			}
+			if len(key) > MaxIdempotencyKeyLen {
+				writeError(w, r, NewValidationError("Idempotency-Key", []Violation{{IdempotencyKeyHeader, fmt.Sprintf("must be at most %v characters long", MaxIdempotencyKeyLen)}}))
+				return
+			}
+
+			r.ParseForm()
+			key = fmt.Sprintf("%v|%v|%v", appFromContext(r.Context()).Name, route.Path, key)
+			stored, err := store.Begin(key, r.Form.Encode())
+			if err != nil {
+				writeError(w, r, err)
+				return
+			}
+			if stored != nil {
+				w.Header().Set("Content-Type", stored.ContentType)
+				w.Header().Set(IdempotentReplayedHeader, strconv.FormatBool(true))
+				w.WriteHeader(stored.Status)
+				w.Write(stored.Body)
+				return
+			}
+
+			recorder := &bodyRecorder{ResponseWriter: w}
+			defer func() {
+				if recorder.status == 0 || recorder.overflow {
+					store.Abandon(key)
+					return
+				}
+				store.Finish(key, recorder.status, recorder.Header().Get("Content-Type"), recorder.body.Bytes())
+			}()
+
+			fn(recorder, r)
+		}
+	}
+}
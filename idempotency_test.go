@@ -0,0 +1,162 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+var _ = Suite(&IdempotencySuite{})
+
+type IdempotencySuite struct {
+	now   time.Time
+	store *IdempotencyStore
+	calls int
+}
+
+func (p *IdempotencySuite) SetUpTest(c *C) {
+	p.now = time.Now()
+	p.store = NewIdempotencyStore(time.Hour, 3, func() time.Time { return p.now })
+	p.calls = 0
+	gobalApps = NewAppRegistry(Config{})
+}
+
+func (p *IdempotencySuite) handler(status int) http.HandlerFunc {
+	return p.handlerWith(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(`{"coins": 7}`))
+	})
+}
+
+func (p *IdempotencySuite) handlerWith(fn http.HandlerFunc) http.HandlerFunc {
+	return Decorate(func(w http.ResponseWriter, r *http.Request) {
+		p.calls++
+		fn(w, r)
+	}, idempotent(p.store, Route{Path: "/v2/coins", Write: true}))
+}
+
+// failing answers err, and panics for nil.
+func (p *IdempotencySuite) failing(err error) http.HandlerFunc {
+	return p.handlerWith(func(w http.ResponseWriter, r *http.Request) {
+		if err == nil {
+			panic("failing")
+		}
+		writeError(w, r, err)
+	})
+}
+
+func (p *IdempotencySuite) serve(handler http.HandlerFunc, key string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/v2/coins?"+body, nil)
+	if key != "" {
+		r.Header.Set(IdempotencyKeyHeader, key)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func (p *IdempotencySuite) Test_idempotent_replay(c *C) {
+	handler := p.handler(http.StatusOK)
+
+	first := p.serve(handler, "k1", "userId=000000001&coins=5")
+	replay := p.serve(handler, "k1", "coins=5&userId=000000001")
+	c.Assert(p.calls, Equals, 1)
+	c.Assert(replay.Code, Equals, http.StatusOK)
+	c.Assert(replay.Body.String(), Equals, first.Body.String())
+	c.Assert(replay.Header().Get("Content-Type"), Equals, "application/json")
+	c.Assert(replay.Header().Get(IdempotentReplayedHeader), Equals, "true")
+	c.Assert(p.store.Replays(), Equals, int64(1))
+
+	// another key, or none, is applied again
+	p.serve(handler, "k2", "userId=000000001&coins=5")
+	p.serve(handler, "", "userId=000000001&coins=5")
+	c.Assert(p.calls, Equals, 3)
+
+	// until the ttl passes
+	p.now = p.now.Add(2 * time.Hour)
+	p.serve(handler, "k1", "userId=000000001&coins=5")
+	c.Assert(p.calls, Equals, 4)
+}
+
+func (p *IdempotencySuite) Test_idempotent_reused(c *C) {
+	handler := p.handler(http.StatusOK)
+	p.serve(handler, "k1", "userId=000000001&coins=5")
+
+	w := p.serve(handler, "k1", "userId=000000001&coins=6")
+	c.Assert(w.Code, Equals, http.StatusUnprocessableEntity)
+	c.Assert(p.calls, Equals, 1)
+}
+
+func (p *IdempotencySuite) Test_idempotent_notAppliedForgotten(c *C) {
+	handler := p.failing(NewError(ERROR_SERVER_BUSY, "busy"))
+	p.serve(handler, "k1", "userId=000000001&coins=5")
+	p.serve(handler, "k1", "userId=000000001&coins=5")
+
+	c.Assert(p.calls, Equals, 2)
+	c.Assert(p.store.Len(), Equals, 0)
+}
+
+func (p *IdempotencySuite) Test_idempotent_timeoutReplayed(c *C) {
+	// the write may have reached mongodb before the deadline passed.
+	handler := p.failing(NewError(ERROR_TIMEOUT, "timeout"))
+	first := p.serve(handler, "k1", "userId=000000001&coins=5")
+	c.Assert(first.Code, Equals, http.StatusGatewayTimeout)
+
+	retry := p.serve(handler, "k1", "userId=000000001&coins=5")
+	c.Assert(p.calls, Equals, 1)
+	c.Assert(retry.Code, Equals, http.StatusGatewayTimeout)
+	c.Assert(retry.Header().Get(IdempotentReplayedHeader), Equals, "true")
+}
+
+func (p *IdempotencySuite) Test_idempotent_panicUnknown(c *C) {
+	handler := Decorate(p.failing(nil), recovering())
+	p.serve(handler, "k1", "userId=000000001&coins=5")
+
+	retry := p.serve(handler, "k1", "userId=000000001&coins=5")
+	c.Assert(p.calls, Equals, 1)
+	c.Assert(retry.Code, Equals, http.StatusConflict)
+	c.Assert(retry.Body.String(), Matches, `.*"code":268435477.*`)
+}
+
+func (p *IdempotencySuite) Test_Begin_inProgress(c *C) {
+	stored, err := p.store.Begin("k1", "a")
+	c.Assert(stored, IsNil)
+	c.Assert(err, IsNil)
+
+	_, err = p.store.Begin("k1", "a")
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_IDEMPOTENCY_IN_PROGRESS)
+
+	p.store.Finish("k1", http.StatusOK, "application/json", []byte("{}"))
+	stored, err = p.store.Begin("k1", "a")
+	c.Assert(err, IsNil)
+	c.Assert(stored.Status, Equals, http.StatusOK)
+}
+
+func (p *IdempotencySuite) Test_idempotent_keyTooLong(c *C) {
+	w := p.serve(p.handler(http.StatusOK), strings.Repeat("k", MaxIdempotencyKeyLen+1), "userId=000000001&coins=5")
+
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	c.Assert(p.calls, Equals, 0)
+}
+
+func (p *IdempotencySuite) Test_Begin_capacity(c *C) {
+	for _, key := range []string{"k1", "k2", "k3"} {
+		p.store.Begin(key, "a")
+		p.store.Finish(key, http.StatusOK, "application/json", []byte("{}"))
+	}
+
+	// k1 is used again, so k2 is the least recently used.
+	p.store.Begin("k1", "a")
+	p.store.Begin("k4", "a")
+	c.Assert(p.store.Len(), Equals, 3)
+	c.Assert(p.store.Evictions(), Equals, int64(1))
+
+	stored, _ := p.store.Begin("k1", "a")
+	c.Assert(stored, NotNil)
+	stored, _ = p.store.Begin("k2", "a")
+	c.Assert(stored, IsNil)
+}
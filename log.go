@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/satori/go.uuid"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	RequestIdHeader    = "X-Request-ID"
+	RequestIdMaxLength = 64
+)
+
+type contextKey int
+
+const (
+	loggerContextKey contextKey = iota
+	appContextKey
+	bodyContextKey
+)
+
+func initLog() {
+	logPath := gobalConfig.LogPath
+	if err := os.MkdirAll(logPath, 0755); err != nil {
+		fmt.Printf("create log folder failed. error=%v\n", err)
+		os.Exit(1)
+	}
+
+	setLogLevelAndFormat(gobalConfig.LogLevel, gobalConfig.LogFormat)
+
+	logName := filepath.Join(logPath, filepath.Base(os.Args[0])+".log")
+	log.SetOutput(newRotateWriter(logName))
+}
+
+// setLogLevelAndFormat applies a validated log level and format.
+func setLogLevelAndFormat(level string, format string) {
+	if l, err := log.ParseLevel(level); err == nil {
+		log.SetLevel(l)
+	}
+
+	if format == "json" {
+		log.SetFormatter(&log.JSONFormatter{})
+	} else {
+		log.SetFormatter(&log.TextFormatter{})
+	}
+}
+
+// newRotateWriter returns a writer which rotates the file when it exceeds LogMaxSize,
+// and additionally every LogRotateInterval if it is set.
+func newRotateWriter(fileName string) *lumberjack.Logger {
+	writer := &lumberjack.Logger{
+		Filename:   fileName,
+		MaxSize:    gobalConfig.LogMaxSize,
+		MaxAge:     gobalConfig.LogMaxAge,
+		MaxBackups: gobalConfig.LogMaxBackups,
+		LocalTime:  true,
+	}
+
+	if gobalConfig.LogRotateInterval > 0 {
+		go func(interval time.Duration) {
+			for range time.Tick(interval) {
+				if err := writer.Rotate(); err != nil {
+					log.Errorf("[newRotateWriter] rotate failed. file=%v error=%v", fileName, err)
+				}
+			}
+		}(gobalConfig.LogRotateInterval)
+	}
+
+	return writer
+}
+
+// requestId takes the X-Request-ID of the request, or generates one if absent, echoes it
+// in the response and attaches it together with the userId to the request logger.
+func requestId() Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIdHeader)
+			if !validRequestId(id) {
+				id = fmt.Sprintf("%v", uuid.NewV4())
+			}
+			w.Header().Set(RequestIdHeader, id)
+
+			r.ParseForm()
+			fields := log.Fields{"requestId": id}
+			if userId := r.Form.Get("userId"); userId != "" {
+				fields["userId"] = userId
+			}
+			if traceId, ok := traceIdField(r.Context()); ok {
+				fields["traceId"] = traceId
+			}
+
+			ctx := context.WithValue(r.Context(), loggerContextKey, log.WithFields(fields))
+			fn(w, r.WithContext(ctx))
+		}
+	}
+}
+
+func validRequestId(id string) bool {
+	if len(id) == 0 || len(id) > RequestIdMaxLength {
+		return false
+	}
+
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
+
+// requestLogger returns the logger of the request, which carries its requestId and userId.
+func requestLogger(ctx context.Context) *log.Entry {
+	if entry, ok := ctx.Value(loggerContextKey).(*log.Entry); ok {
+		return entry
+	}
+
+	return log.NewEntry(log.StandardLogger())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	log "github.com/sirupsen/logrus"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Suite(&LogSuite{})
+
+type LogSuite struct{}
+
+// serve runs a request with header through requestId, and returns the response and the
+// logger seen by the handler.
+func (p *LogSuite) serve(url string, header string) (*httptest.ResponseRecorder, *log.Entry) {
+	var entry *log.Entry
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {
+		entry = requestLogger(r.Context())
+	}, requestId())
+
+	r := httptest.NewRequest("GET", url, nil)
+	if header != "" {
+		r.Header.Set(RequestIdHeader, header)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	return w, entry
+}
+
+func (p *LogSuite) Test_requestId_kept(c *C) {
+	w, entry := p.serve("/getfollowers/info?userId=000000001", "req-1")
+
+	c.Assert(w.Header().Get(RequestIdHeader), Equals, "req-1")
+	c.Assert(entry.Data["requestId"], Equals, "req-1")
+	c.Assert(entry.Data["userId"], Equals, "000000001")
+}
+
+func (p *LogSuite) Test_requestId_generated(c *C) {
+	for _, header := range []string{"", "has space", strings.Repeat("a", RequestIdMaxLength+1)} {
+		w, entry := p.serve("/getfollowers/errors", header)
+
+		id := w.Header().Get(RequestIdHeader)
+		c.Assert(id, HasLen, 36, Commentf("header %q", header))
+		c.Assert(entry.Data["requestId"], Equals, id)
+		_, ok := entry.Data["userId"]
+		c.Assert(ok, Equals, false)
+	}
+
+	w1, _ := p.serve("/getfollowers/errors", "")
+	w2, _ := p.serve("/getfollowers/errors", "")
+	c.Assert(w1.Header().Get(RequestIdHeader), Not(Equals), w2.Header().Get(RequestIdHeader))
+}
+
+func (p *LogSuite) Test_validRequestId(c *C) {
+	c.Assert(validRequestId("0b7f3c1e-7d0e-4f1a-9d5e-4b3a2c1d0e9f"), Equals, true)
+	c.Assert(validRequestId(strings.Repeat("a", RequestIdMaxLength)), Equals, true)
+	c.Assert(validRequestId(""), Equals, false)
+	c.Assert(validRequestId(strings.Repeat("a", RequestIdMaxLength+1)), Equals, false)
+	c.Assert(validRequestId("a b"), Equals, false)
+	c.Assert(validRequestId("a\nb"), Equals, false)
+	c.Assert(validRequestId("é"), Equals, false)
+}
+
+func (p *LogSuite) Test_requestLogger_default(c *C) {
+	c.Assert(requestLogger(httptest.NewRequest("GET", "/", nil).Context()).Data, HasLen, 0)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MaintenanceState is set through /admin/maintenance. While enabled, the client routes in
+// Routes, or all of them if Routes is empty, answer ERROR_MAINTENANCE. Routes holds paths or
+// operations, and a path covers every route and grpc method of its operation, so
+// /getfollowers/buyfollower also stops /v2/buyfollower.
+type MaintenanceState struct {
+	Enabled bool       `json:"enabled"`
+	Message string     `json:"message,omitempty"`
+	Eta     *time.Time `json:"eta,omitempty"`
+	Routes  []string   `json:"routes,omitempty"`
+}
+
+type Maintenance struct {
+	mutex sync.RWMutex
+	state MaintenanceState
+}
+
+var gobalMaintenance Maintenance
+
+func (p *Maintenance) State() MaintenanceState {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.state
+}
+
+func (p *Maintenance) Set(state MaintenanceState) {
+	p.mutex.Lock()
+	p.state = state
+	p.mutex.Unlock()
+
+	log.WithFields(log.Fields{"enabled": state.Enabled, "message": state.Message, "eta": state.Eta, "routes": state.Routes}).Warn("maintenance changed")
+}
+
+// Active returns the state if operation is under maintenance.
+func (p *Maintenance) Active(operation string) (MaintenanceState, bool) {
+	state := p.State()
+	if !state.Enabled {
+		return state, false
+	}
+	if len(state.Routes) == 0 {
+		return state, true
+	}
+
+	for _, route := range state.Routes {
+		if operationOf(route) == operation {
+			return state, true
+		}
+	}
+
+	return state, false
+}
+
+// maintenanceError tells the message and eta of the maintenance of route.
+func maintenanceError(state MaintenanceState, route string) error {
+	msg := "service under maintenance"
+	if state.Message != "" {
+		msg += ": " + state.Message
+	}
+	if state.Eta != nil {
+		msg += fmt.Sprintf(". expected back at %v", state.Eta.UTC().Format(time.RFC3339))
+	}
+
+	return NewErrorMsg(ERROR_MAINTENANCE, msg, "[underMaintenance] %v. route=%v", msg, route)
+}
+
+// underMaintenance rejects the requests of operation with ERROR_MAINTENANCE while it is
+// under maintenance, with a Retry-After header if the eta is known.
+func underMaintenance(maintenance *Maintenance, operation string) Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if state, ok := maintenance.Active(operation); ok {
+				if state.Eta != nil {
+					if wait := time.Until(*state.Eta); wait > 0 {
+						w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					}
+				}
+
+				writeError(w, r, maintenanceError(state, r.URL.Path))
+				return
+			}
+
+			fn(w, r)
+		}
+	}
+}
+
+// maintenanceHandler shows the maintenance state on GET, replaces it with the json body on
+// PUT, and ends the maintenance on DELETE.
+func maintenanceHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var state MaintenanceState
+		if err := json.NewDecoder(r.Body).Decode(&state); err != nil {
+			http.Error(w, fmt.Sprintf("invalid maintenance state: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		for _, route := range state.Routes {
+			if !isClientRoute(route) && !isClientOperation(route) {
+				http.Error(w, fmt.Sprintf("unknown client route %v", route), http.StatusBadRequest)
+				return
+			}
+		}
+
+		gobalMaintenance.Set(state)
+	case http.MethodDelete:
+		gobalMaintenance.Set(MaintenanceState{})
+	default:
+		w.Header().Set("Allow", "GET, PUT, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(gobalMaintenance.State())
+}
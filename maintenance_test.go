@@ -0,0 +1,66 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+var _ = Suite(&MaintenanceSuite{})
+
+type MaintenanceSuite struct{}
+
+func (p *MaintenanceSuite) TearDownTest(c *C) {
+	gobalMaintenance.Set(MaintenanceState{})
+}
+
+func (p *MaintenanceSuite) serve(route string) *httptest.ResponseRecorder {
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, underMaintenance(&gobalMaintenance, operationOf(route)))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", route, nil))
+	return w
+}
+
+func (p *MaintenanceSuite) Test_maintenanceHandler_perRoute(c *C) {
+	eta := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	body := `{"enabled": true, "message": "migrating orders", "eta": "` + eta + `", "routes": ["/getfollowers/buyfollower"]}`
+	w := httptest.NewRecorder()
+	maintenanceHandler(w, httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(body)))
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	w = p.serve("/getfollowers/buyfollower")
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(w.Header().Get("Retry-After"), Not(Equals), "")
+	c.Assert(strings.Contains(w.Body.String(), "migrating orders"), Equals, true)
+	c.Assert(strings.Contains(w.Body.String(), eta), Equals, true)
+
+	c.Assert(p.serve("/v2/buyfollower").Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(p.serve("/getfollowers/info").Code, Equals, http.StatusOK)
+
+	w = httptest.NewRecorder()
+	maintenanceHandler(w, httptest.NewRequest("DELETE", "/admin/maintenance", nil))
+	c.Assert(p.serve("/getfollowers/buyfollower").Code, Equals, http.StatusOK)
+}
+
+func (p *MaintenanceSuite) Test_maintenanceHandler_unknownRoute(c *C) {
+	w := httptest.NewRecorder()
+	maintenanceHandler(w, httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(`{"enabled": true, "routes": ["/nope"]}`)))
+
+	c.Assert(w.Code, Equals, http.StatusBadRequest)
+	c.Assert(gobalMaintenance.State().Enabled, Equals, false)
+}
+
+func (p *MaintenanceSuite) Test_maintenanceHandler_operation(c *C) {
+	w := httptest.NewRecorder()
+	maintenanceHandler(w, httptest.NewRequest("PUT", "/admin/maintenance", strings.NewReader(`{"enabled": true, "routes": ["coins"]}`)))
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	c.Assert(p.serve("/getfollowers/coins").Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(p.serve("/v2/coins").Code, Equals, http.StatusServiceUnavailable)
+	c.Assert(p.serve("/v2/info").Code, Equals, http.StatusOK)
+}
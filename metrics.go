@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// metricsHandler exports the counters in the prometheus text format.
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+
+	writeMetric(&b, "follower_requests_total", "counter", "Client requests served.", gobalCounter.Request())
+	writeMetric(&b, "follower_request_latency_nanoseconds_total", "counter", "Total latency of the client requests.", gobalCounter.Latency())
+	writeMetric(&b, "follower_request_latency_nanoseconds_average", "gauge", "Average latency of the client requests.", gobalCounter.AveLatency())
+	writeMetric(&b, "follower_requests_per_second", "gauge", "Client requests in the last second.", gobalCounter.RequestPerSecond())
+
+	fmt.Fprintf(&b, "# HELP follower_pending_orders Orders waiting for followers.\n# TYPE follower_pending_orders gauge\n")
+	for _, app := range gobalApps.All() {
+		fmt.Fprintf(&b, "follower_pending_orders{app=%q} %d\n", app.Name, app.PushManager.Len())
+	}
+
+	if gobalConcurrencyLimiter != nil {
+		stats := gobalConcurrencyLimiter.Stats()
+		writeMetric(&b, "follower_concurrency_limit", "gauge", "Current limit of client requests served at once.", int64(stats.Limit))
+		writeMetric(&b, "follower_in_flight_requests", "gauge", "Client requests being served.", int64(stats.InFlight))
+		writeMetric(&b, "follower_queued_requests", "gauge", "Client requests waiting for a slot.", int64(stats.Queued))
+		writeMetric(&b, "follower_shed_requests_total", "counter", "Client requests rejected as the server was busy.", stats.Shed)
+	}
+
+	writeMetric(&b, "follower_grpc_watches", "gauge", "WatchProgress streams running.", gobalWatches.Running())
+	writeMetric(&b, "follower_grpc_watches_total", "counter", "WatchProgress streams started.", gobalWatches.Total())
+
+	writeMetric(&b, "follower_db_breaker_state", "gauge", "State of the mongodb circuit breaker: 0 closed, 1 open, 2 half open.", int64(gobalDbBreaker.State()))
+	writeMetric(&b, "follower_db_breaker_trips_total", "counter", "Times the mongodb circuit breaker opened.", gobalDbBreaker.Trips())
+	writeMetric(&b, "follower_db_retries_total", "counter", "Retried mongodb reads.", atomic.LoadInt64(&gobalDbRetries))
+
+	writeMetric(&b, "follower_user_cache_entries", "gauge", "Cached info and progress results.", int64(gobalUserCache.Len()))
+	writeMetric(&b, "follower_stale_responses_total", "counter", "Cached results served while mongodb was unavailable.", gobalUserCache.Stale())
+
+	if gobalIdempotencyStore != nil {
+		writeMetric(&b, "follower_idempotency_keys", "gauge", "Idempotency-Key responses kept.", int64(gobalIdempotencyStore.Len()))
+		writeMetric(&b, "follower_idempotent_replays_total", "counter", "Write requests answered with the response of an earlier request with their Idempotency-Key.", gobalIdempotencyStore.Replays())
+		writeMetric(&b, "follower_idempotency_evictions_total", "counter", "Idempotency-Key responses dropped before their ttl as idempotency_max_keys was reached.", gobalIdempotencyStore.Evictions())
+	}
+	writeMetric(&b, "follower_nonconformant_responses_total", "counter", "Client responses which differ from the openapi document, with validate_responses.", atomic.LoadInt64(&gobalNonconformantResponses))
+
+	maintenance := 0
+	if gobalMaintenance.State().Enabled {
+		maintenance = 1
+	}
+	writeMetric(&b, "follower_maintenance", "gauge", "1 while client routes are under maintenance.", int64(maintenance))
+
+	draining := 0
+	if isDraining() {
+		draining = 1
+	}
+	writeMetric(&b, "follower_draining", "gauge", "1 while the server shuts down.", int64(draining))
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
+
+func writeMetric(b *strings.Builder, name string, kind string, help string, value int64) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
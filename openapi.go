@@ -0,0 +1,400 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+const (
+	OpenApiVersion    = "3.0.3"
+	OpenApiSchemaPath = "#/components/schemas/"
+)
+
+// OpenApi is the OpenAPI 3 document of the client api, generated from clientRoutes by
+// NewOpenApi.
+type OpenApi struct {
+	Openapi    string                          `json:"openapi"`
+	Info       OpenApiInfo                     `json:"info"`
+	Paths      map[string]map[string]Operation `json:"paths"`
+	Components OpenApiComponents               `json:"components"`
+}
+
+type OpenApiInfo struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type OpenApiComponents struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+type Operation struct {
+	OperationId string                     `json:"operationId"`
+	Description string                     `json:"description,omitempty"`
+	Parameters  []Parameter                `json:"parameters,omitempty"`
+	RequestBody *RequestBody               `json:"requestBody,omitempty"`
+	Responses   map[string]OpenApiResponse `json:"responses"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required,omitempty"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type OpenApiResponse struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Enum                 []int64            `json:"enum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+// gobalOpenApi validates the client responses when validate_responses is set, and is nil
+// otherwise.
+var gobalOpenApi *OpenApi
+
+var gobalNonconformantResponses int64
+
+// NewOpenApi documents routes. The v1 routes, which accept any method, are documented as
+// GET. The parameters of POST routes are documented as a json body, the others as query
+// parameters.
+func NewOpenApi(routes []Route) *OpenApi {
+	doc := &OpenApi{
+		Openapi: OpenApiVersion,
+		Info: OpenApiInfo{
+			Title:       "follower",
+			Description: "The client api. Every route also takes the optional app and lang parameters.",
+			Version:     "2",
+		},
+		Paths:      make(map[string]map[string]Operation),
+		Components: OpenApiComponents{Schemas: make(map[string]*Schema)},
+	}
+
+	errorSchema := doc.schemaOf(reflect.TypeOf(FollowerError{}))
+	problemSchema := doc.schemaOf(reflect.TypeOf(Problem{}))
+
+	for _, route := range routes {
+		method := route.Method
+		if method == "" {
+			method = http.MethodGet
+		}
+
+		op := Operation{
+			OperationId: operationId(route.Path),
+			Responses: map[string]OpenApiResponse{
+				"default": {Description: "an error of the error catalog", Content: map[string]MediaType{
+					"application/json": {errorSchema},
+					ProblemContentType: {problemSchema},
+				}},
+			},
+		}
+		if route.Method == "" {
+			op.Description = "Accepts any method."
+		}
+
+		if route.Request != nil {
+			specs := paramSpecs(reflect.TypeOf(route.Request))
+			if method == http.MethodPost {
+				op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {paramsSchema(specs)}}}
+			} else {
+				for _, spec := range specs {
+					op.Parameters = append(op.Parameters, Parameter{spec.Name, "query", spec.Required, paramSchema(spec)})
+				}
+			}
+		}
+		op.Parameters = append(op.Parameters,
+			Parameter{Name: AppParam, In: "query", Schema: &Schema{Type: "string"}},
+			Parameter{Name: LangParam, In: "query", Schema: &Schema{Type: "string"}})
+		if route.Write {
+			maxLength := MaxIdempotencyKeyLen
+			op.Parameters = append(op.Parameters, Parameter{Name: IdempotencyKeyHeader, In: "header", Schema: &Schema{Type: "string", MaxLength: &maxLength}})
+		}
+
+		if route.Response != nil {
+			op.Responses["200"] = OpenApiResponse{Description: "success", Content: map[string]MediaType{
+				"application/json": {doc.schemaOf(reflect.TypeOf(route.Response))},
+			}}
+		}
+
+		if doc.Paths[route.Path] == nil {
+			doc.Paths[route.Path] = make(map[string]Operation)
+		}
+		doc.Paths[route.Path][strings.ToLower(method)] = op
+	}
+
+	return doc
+}
+
+// operationId joins the segments of path in camel case, e.g. v2Coins for /v2/coins.
+func operationId(path string) string {
+	var b strings.Builder
+	for i, segment := range strings.Split(strings.Trim(path, "/"), "/") {
+		if i > 0 && segment != "" {
+			runes := []rune(segment)
+			runes[0] = unicode.ToUpper(runes[0])
+			segment = string(runes)
+		}
+		b.WriteString(segment)
+	}
+
+	return b.String()
+}
+
+// paramSchema translates the rules of spec.
+func paramSchema(spec ParamSpec) *Schema {
+	if spec.Kind == reflect.String {
+		schema := &Schema{Type: "string"}
+		if spec.UserId {
+			length := currentConfig().UserIdLen
+			schema.MinLength, schema.MaxLength = &length, &length
+		}
+		return schema
+	}
+
+	schema := &Schema{Type: "integer", Format: "int64", Minimum: spec.Min, Maximum: spec.Max}
+	if spec.Version {
+		schema.Enum = currentVersions().Supported(time.Now())
+	}
+
+	return schema
+}
+
+func paramsSchema(specs []ParamSpec) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, spec := range specs {
+		schema.Properties[spec.Name] = paramSchema(spec)
+		if spec.Required {
+			schema.Required = append(schema.Required, spec.Name)
+		}
+	}
+
+	return schema
+}
+
+// schemaOf returns the schema of the json encoding of t. Structs are added to the
+// components and referenced by their type name, and fields without omitempty are required.
+func (p *OpenApi) schemaOf(t reflect.Type) *Schema {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return p.schemaOf(t.Elem())
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: p.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: p.schemaOf(t.Elem())}
+	case reflect.Struct:
+		ref := &Schema{Ref: OpenApiSchemaPath + t.Name()}
+		if _, ok := p.Components.Schemas[t.Name()]; ok {
+			return ref
+		}
+
+		schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+		p.Components.Schemas[t.Name()] = schema
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := strings.Split(field.Tag.Get("json"), ",")
+			if field.PkgPath != "" || tag[0] == "-" {
+				continue
+			}
+
+			name := tag[0]
+			if name == "" {
+				name = field.Name
+			}
+			schema.Properties[name] = p.schemaOf(field.Type)
+			if len(tag) == 1 || tag[1] != "omitempty" {
+				schema.Required = append(schema.Required, name)
+			}
+		}
+
+		return ref
+	}
+
+	// any value
+	return &Schema{}
+}
+
+func (p *OpenApi) resolve(schema *Schema) *Schema {
+	if schema.Ref == "" {
+		return schema
+	}
+
+	return p.Components.Schemas[strings.TrimPrefix(schema.Ref, OpenApiSchemaPath)]
+}
+
+// ValidateResponse reports how a response of the route differs from the document.
+func (p *OpenApi) ValidateResponse(route Route, status int, header http.Header, body []byte) []string {
+	method := route.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	op, ok := p.Paths[route.Path][strings.ToLower(method)]
+	if !ok {
+		return []string{fmt.Sprintf("route %v %v is not documented", method, route.Path)}
+	}
+
+	response, ok := op.Responses[strconv.Itoa(status)]
+	if !ok && status >= http.StatusBadRequest {
+		response, ok = op.Responses["default"]
+	}
+	if !ok {
+		return []string{fmt.Sprintf("status %v is not documented", status)}
+	}
+
+	contentType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	media, ok := response.Content[contentType]
+	if !ok {
+		return []string{fmt.Sprintf("content type %q is not documented for status %v", contentType, status)}
+	}
+
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return []string{fmt.Sprintf("invalid json body: %v", err)}
+	}
+
+	return p.validate(media.Schema, value, "body")
+}
+
+func (p *OpenApi) validate(schema *Schema, value interface{}, path string) []string {
+	schema = p.resolve(schema)
+	if schema == nil {
+		return nil
+	}
+
+	mismatch := []string{fmt.Sprintf("%v must be %v, got %T", path, schema.Type, value)}
+	switch schema.Type {
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return mismatch
+		}
+
+		var problems []string
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%v.%v is required", path, name))
+			}
+		}
+		for name, v := range object {
+			if property, ok := schema.Properties[name]; ok {
+				problems = append(problems, p.validate(property, v, path+"."+name)...)
+			} else if schema.AdditionalProperties != nil {
+				problems = append(problems, p.validate(schema.AdditionalProperties, v, path+"."+name)...)
+			}
+		}
+		return problems
+	case "array":
+		array, ok := value.([]interface{})
+		if !ok {
+			return mismatch
+		}
+
+		var problems []string
+		for i, v := range array {
+			problems = append(problems, p.validate(schema.Items, v, fmt.Sprintf("%v[%v]", path, i))...)
+		}
+		return problems
+	case "string":
+		if _, ok := value.(string); !ok {
+			return mismatch
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return mismatch
+		}
+	case "integer":
+		n, ok := value.(json.Number)
+		if !ok {
+			return mismatch
+		}
+		if _, err := n.Int64(); err != nil {
+			return mismatch
+		}
+	case "number":
+		if _, ok := value.(json.Number); !ok {
+			return mismatch
+		}
+	}
+
+	return nil
+}
+
+// conformance validates the responses of the route against doc, and logs and counts those
+// which differ. It is a debug aid and does nothing if doc is nil.
+func conformance(doc *OpenApi, route Route) Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		if doc == nil {
+			return fn
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			recorder := &bodyRecorder{ResponseWriter: w}
+			fn(recorder, r)
+
+			if recorder.status == 0 || recorder.overflow {
+				return
+			}
+
+			if problems := doc.ValidateResponse(route, recorder.status, recorder.Header(), recorder.body.Bytes()); len(problems) != 0 {
+				atomic.AddInt64(&gobalNonconformantResponses, 1)
+				requestLogger(r.Context()).WithFields(log.Fields{
+					"route":    route.Path,
+					"status":   recorder.status,
+					"problems": strings.Join(problems, "; "),
+				}).Warn("[conformance] response does not conform to the openapi document")
+			}
+		}
+	}
+}
+
+// openApiHandler serves the openapi document of the client api.
+func openApiHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(NewOpenApi(clientRoutes)); err != nil {
+		log.Errorf("[openApiHandler] json encode failed. error=%v", err)
+	}
+}
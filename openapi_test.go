@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	. "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+)
+
+var _ = Suite(&OpenApiSuite{})
+
+type OpenApiSuite struct{}
+
+func (p *OpenApiSuite) SetUpTest(c *C) {
+	gobalConfig.UserIdLen = DefaultUserIdLen
+	gobalConfig.Versions = DefaultVersions
+}
+
+func (p *OpenApiSuite) Test_NewOpenApi(c *C) {
+	doc := NewOpenApi(clientRoutes)
+	for _, route := range clientRoutes {
+		c.Assert(len(doc.Paths[route.Path]), Equals, 1, Commentf("route %v", route.Path))
+	}
+
+	coins := doc.Paths["/getfollowers/coins"]["get"]
+	c.Assert(coins.OperationId, Equals, "getfollowersCoins")
+	c.Assert(coins.RequestBody, IsNil)
+	c.Assert(coins.Parameters[0].Name, Equals, "userId")
+	c.Assert(*coins.Parameters[0].Schema.MinLength, Equals, DefaultUserIdLen)
+	c.Assert(coins.Parameters[1].Schema.Enum, DeepEquals, []int64{1})
+
+	buy := doc.Paths["/v2/buyfollower"]["post"]
+	body := buy.RequestBody.Content["application/json"].Schema
+	c.Assert(body.Required, DeepEquals, []string{"userId", "coins", "value"})
+	c.Assert(*body.Properties["value"].Minimum, Equals, int64(1))
+	c.Assert(buy.Responses["200"].Content["application/json"].Schema.Ref, Equals, "#/components/schemas/BuyFollowerResponse")
+	c.Assert(buy.Responses["default"].Content[ProblemContentType].Schema.Ref, Equals, "#/components/schemas/Problem")
+
+	info := doc.Components.Schemas["InfoResponse"]
+	c.Assert(info.Required, DeepEquals, []string{"userId", "coins"})
+	c.Assert(info.Properties["orders"].Items.Ref, Equals, "#/components/schemas/OrderProgress")
+
+	_, err := json.Marshal(doc)
+	c.Assert(err, IsNil)
+}
+
+func (p *OpenApiSuite) Test_ValidateResponse(c *C) {
+	doc := NewOpenApi(clientRoutes)
+	route := Route{Path: "/getfollowers/info"}
+	header := http.Header{"Content-Type": {"application/json"}}
+
+	problems := doc.ValidateResponse(route, http.StatusOK, header, []byte(`{"userId": "000000001", "coins": 3, "orders": [{"fans": 2, "progress": 1, "status": false}]}`))
+	c.Assert(problems, HasLen, 0)
+
+	problems = doc.ValidateResponse(route, http.StatusOK, header, []byte(`{"userId": "000000001", "orders": [{"fans": "2", "progress": 1, "status": false}]}`))
+	c.Assert(problems, HasLen, 2)
+
+	problems = doc.ValidateResponse(route, http.StatusNotFound, header, []byte(`{"code": 268435461, "errMsg": "user not found"}`))
+	c.Assert(problems, HasLen, 0)
+
+	problems = doc.ValidateResponse(route, http.StatusOK, http.Header{"Content-Type": {"text/plain"}}, []byte(`{}`))
+	c.Assert(problems, HasLen, 1)
+
+	problems = doc.ValidateResponse(route, http.StatusNoContent, header, nil)
+	c.Assert(problems, DeepEquals, []string{"status 204 is not documented"})
+}
+
+func (p *OpenApiSuite) Test_fromBson_conforms(c *C) {
+	// a cached info result, as decoded from mongodb and marked stale by the cache.
+	result := bson.M{
+		"userId":   "000000001",
+		"coins":    3,
+		"orders":   []interface{}{bson.M{"fans": int64(2), "progress": int64(1), "status": false}},
+		"stale":    true,
+		"cachedAt": int64(1500000000),
+	}
+
+	var resp InfoResponse
+	c.Assert(fromBson(result, &resp), IsNil)
+	c.Assert(resp, DeepEquals, InfoResponse{"000000001", 3, []OrderProgress{{2, 1, false}}, true, 1500000000})
+
+	body, err := json.Marshal(resp)
+	c.Assert(err, IsNil)
+	problems := NewOpenApi(clientRoutes).ValidateResponse(Route{Path: "/v2/info"}, http.StatusOK, http.Header{"Content-Type": {"application/json"}}, body)
+	c.Assert(problems, HasLen, 0)
+}
+
+func (p *OpenApiSuite) Test_conformance(c *C) {
+	route := Route{Method: http.MethodPost, Path: "/v2/coins"}
+	handler := Decorate(handle(func(w http.ResponseWriter, r *http.Request) error {
+		return responseToClient(w, map[string]interface{}{"coins": 1})
+	}), conformance(NewOpenApi(clientRoutes), route))
+
+	before := atomic.LoadInt64(&gobalNonconformantResponses)
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("POST", "/v2/coins", strings.NewReader("{}")))
+
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(atomic.LoadInt64(&gobalNonconformantResponses), Equals, before+1)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strings"
+)
+
+const ProblemContentType = "application/problem+json"
+
+// Problem is the RFC 7807 form of a FollowerError, with its code, catalog name and
+// invalid parameters as extension members.
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	Code     int    `json:"code"`
+	Name     string `json:"name,omitempty"`
+
+	InvalidParams []Violation `json:"invalidParams,omitempty"`
+}
+
+func NewProblem(r *http.Request, e FollowerError) Problem {
+	status := httpStatus(e.Code)
+	return Problem{
+		Type:     "urn:follower:error:" + e.Name,
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   e.Msg,
+		Instance: r.URL.Path,
+		Code:     e.Code,
+		Name:     e.Name,
+
+		InvalidParams: e.Violations,
+	}
+}
+
+// wantsProblem reports whether the client accepts application/problem+json.
+func wantsProblem(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if strings.TrimSpace(strings.Split(accept, ";")[0]) == ProblemContentType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, e FollowerError) {
+	problem := NewProblem(r, e)
+	bProblem, err := json.Marshal(problem)
+	if err != nil {
+		log.Errorf("[writeProblem] json.Marshal failed. error=%v", err)
+		w.WriteHeader(problem.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.WriteHeader(problem.Status)
+	w.Write(bProblem)
+}
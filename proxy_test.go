@@ -0,0 +1,53 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"net/http/httptest"
+)
+
+var _ = Suite(&ProxySuite{})
+
+type ProxySuite struct{}
+
+func (p *ProxySuite) SetUpTest(c *C) {
+	var err error
+	gobalTrustedProxies, err = parseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	c.Assert(err, IsNil)
+}
+
+func (p *ProxySuite) TearDownTest(c *C) {
+	gobalTrustedProxies = nil
+}
+
+func (p *ProxySuite) Test_clientIP_untrustedRemote(c *C) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "1.2.3.4:5000"
+	r.Header.Set("X-Forwarded-For", "5.6.7.8")
+
+	c.Assert(clientIP(r), Equals, "1.2.3.4")
+	c.Assert(requestScheme(r), Equals, "http")
+}
+
+func (p *ProxySuite) Test_clientIP_trustedChain(c *C) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "192.168.1.1:5000"
+	r.Header.Add("X-Forwarded-For", "9.9.9.9, 5.6.7.8")
+	r.Header.Add("X-Forwarded-For", "10.1.2.3")
+	r.Header.Set("X-Forwarded-Proto", "https")
+
+	c.Assert(clientIP(r), Equals, "5.6.7.8")
+	c.Assert(requestScheme(r), Equals, "https")
+}
+
+func (p *ProxySuite) Test_clientIP_allTrusted(c *C) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set("X-Forwarded-For", "10.0.0.2")
+
+	c.Assert(clientIP(r), Equals, "10.0.0.2")
+}
+
+func (p *ProxySuite) Test_parseTrustedProxies_invalid(c *C) {
+	_, err := parseTrustedProxies([]string{"10.0.0.0/33"})
+	c.Assert(err, NotNil)
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
-	"fmt"
+	"context"
 	"github.com/petar/GoLLRB/llrb"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/attribute"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
-	"net/http"
-	"sync"
+	"sync/atomic"
 )
 
 type Order struct {
@@ -22,50 +24,78 @@ type PushItem struct {
 	UserId string
 }
 
+// Less orders the items by (Date, UserId, OrderId), so that Delete finds every order of a
+// date.
 func (p PushItem) Less(than llrb.Item) bool {
-	if p.Order.Date < than.(*PushItem).Order.Date {
-		return true
-	} else if p.Order.Date > than.(*PushItem).Order.Date {
-		return false
+	other := than.(*PushItem)
+	if p.Order.Date != other.Order.Date {
+		return p.Order.Date < other.Order.Date
+	} else if p.UserId != other.UserId {
+		return p.UserId < other.UserId
 	} else {
-		return p.UserId != than.(*PushItem).UserId
+		return p.Order.OrderId < other.Order.OrderId
 	}
 }
 
+// PushManager keeps the pending orders of an app in date order. Its lock is a channel so
+// that push can stop waiting for it when the request deadline passes.
 type PushManager struct {
-	mutex sync.Mutex
-	items llrb.LLRB
+	locker   chan struct{}
+	items    llrb.LLRB
+	loaded   int32
+	dbName   string
+	collName string
 }
 
-var gobalPushManger = PushManager{}
+func NewPushManager(dbName string, collName string) *PushManager {
+	return &PushManager{locker: make(chan struct{}, 1), dbName: dbName, collName: collName}
+}
 
-func (p *PushManager) Add(item *PushItem) {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+// Add waits for the lock regardless of the deadline of ctx, the order is already stored in
+// mongodb and must not be lost.
+func (p *PushManager) Add(ctx context.Context, item *PushItem) {
+	p.lock(context.WithoutCancel(ctx))
+	defer p.unlock()
 
 	p.items.InsertNoReplace(item)
 }
 
-func (p *PushManager) push(w http.ResponseWriter, userId string, num int) error {
-	session := gobalMgoSession.Copy()
-	collection := session.DB("follower").C("user")
+// push picks up to num buyers for the user to follow, records their progress and then hands
+// them to respond, so that a failed update never follows a written response.
+func (p *PushManager) push(ctx context.Context, userId string, num int, respond func(userIds []string) error) error {
+	logger := requestLogger(ctx)
+
+	session, err := newDbSession(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	collection := session.DB(p.dbName).C(p.collName)
 	query := collection.Find(bson.M{"userId": userId}).Select(bson.M{"_id": 0, "lastPushDate": 1})
 	var result bson.M
-	err := query.One(&result)
-	if err != nil {
-		return NewError(ERROR_DB_OPERATE_FAIELD, "[PushManager.push] query.one failed. error=%v", err)
+	_, span := startDbSpan(ctx, "find", collection)
+	err = dbRetry(ctx, session, func() error { return query.One(&result) })
+	endSpan(span, err)
+	if err == mgo.ErrNotFound {
+		return NewError(ERROR_USER_NOT_FOUND, "[PushManager.push] user not found. userId=%v", userId)
+	} else if err != nil {
+		return dbError(ctx, err, ERROR_DB_OPERATE_FAIELD, "[PushManager.push] query.one failed. error=%v", err)
 	}
 
 	lastPushDate := result["lastPushDate"].(int64)
 
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+	if err := p.lock(ctx); err != nil {
+		return err
+	}
+	defer p.unlock()
 
-	order := &Order{Date: lastPushDate}
-	item := &PushItem{Order: order, UserId: userId}
+	// the pivot sorts before every order of lastPushDate
+	item := &PushItem{Order: &Order{Date: lastPushDate}}
 	pushList := make([]*PushItem, 0, num)
+	_, walkSpan := tracer.Start(ctx, "PushManager.walk")
 	p.items.AscendGreaterOrEqual(item, func(i llrb.Item) bool {
-		fmt.Println(i.(*PushItem).Order.OrderId)
+		logger.Debugf("[PushManager.push] candidate order. orderId=%v", i.(*PushItem).Order.OrderId)
 		if i.(*PushItem).Order.Date == lastPushDate && i.(*PushItem).UserId == userId {
 			return true
 		}
@@ -76,6 +106,8 @@ func (p *PushManager) push(w http.ResponseWriter, userId string, num int) error
 
 		return true
 	})
+	walkSpan.SetAttributes(attribute.Int("push.count", len(pushList)))
+	walkSpan.End()
 
 	if len(pushList) == 0 {
 		return NewError(ERROR_NO_BUYER, "[PushManager.push] no buyer")
@@ -86,18 +118,12 @@ func (p *PushManager) push(w http.ResponseWriter, userId string, num int) error
 		userIDs = append(userIDs, v.UserId)
 	}
 
-	err = responseToClient(w, bson.M{"userIDs": userIDs})
-	if err != nil {
-		return err
-	}
-
 	var s bson.M
 	var u bson.M
 	updatePairs := make([]interface{}, 0, len(pushList)*2+1)
 
 	for _, item := range pushList {
-		fmt.Println(item.Order.Fans)
-		fmt.Println(item.Order.Progress)
+		logger.WithFields(log.Fields{"orderId": item.Order.OrderId, "fans": item.Order.Fans, "progress": item.Order.Progress}).Debug("[PushManager.push] push order")
 
 		if item.Order.Progress+1 == item.Order.Fans {
 			u = bson.M{"$set": bson.M{"orders.$.progress": item.Order.Progress + 1, "orders.$.status": true}}
@@ -122,9 +148,14 @@ func (p *PushManager) push(w http.ResponseWriter, userId string, num int) error
 		bulk.Update(updatePairs[i], updatePairs[i+1])
 	}
 
-	_, err = bulk.Run()
+	_, span = startDbSpan(ctx, "bulkUpdate", collection)
+	err = dbDo(ctx, func() error {
+		_, err := bulk.Run()
+		return err
+	})
+	endSpan(span, err)
 	if err != nil {
-		return NewError(ERROR_DB_OPERATE_FAIELD, "[PushManager.push] bulk.run failed. error=%v", err)
+		return dbError(ctx, err, ERROR_DB_OPERATE_FAIELD, "[PushManager.push] bulk.run failed. error=%v", err)
 	}
 
 	for _, v := range pushList {
@@ -135,12 +166,48 @@ func (p *PushManager) push(w http.ResponseWriter, userId string, num int) error
 		}
 	}
 
-	return nil
+	return respond(userIDs)
+}
+
+// SetLoaded marks the pending orders as loaded from mongodb.
+func (p *PushManager) SetLoaded() {
+	atomic.StoreInt32(&p.loaded, 1)
+}
+
+func (p *PushManager) Loaded() bool {
+	return atomic.LoadInt32(&p.loaded) == 1
+}
+
+// Len returns the number of pending orders.
+func (p *PushManager) Len() int {
+	p.lock(context.Background())
+	defer p.unlock()
+
+	return p.items.Len()
+}
+
+// lock acquires the lock, recording the wait in a span. It returns ERROR_TIMEOUT if ctx is
+// done first.
+func (p *PushManager) lock(ctx context.Context) error {
+	_, span := tracer.Start(ctx, "PushManager.lock")
+	select {
+	case p.locker <- struct{}{}:
+		span.End()
+		return nil
+	case <-ctx.Done():
+		err := NewError(ERROR_TIMEOUT, "[PushManager.lock] wait for lock failed. error=%v", ctx.Err())
+		endSpan(span, err)
+		return err
+	}
+}
+
+func (p *PushManager) unlock() {
+	<-p.locker
 }
 
 func (p *PushManager) GetPushItems(key PushItem, itemNum int) []*PushItem {
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
+	p.lock(context.Background())
+	defer p.unlock()
 
 	result := make([]*PushItem, 0, itemNum)
 	p.items.AscendGreaterOrEqual(key, func(i llrb.Item) bool {
@@ -155,6 +222,9 @@ func (p *PushManager) GetPushItems(key PushItem, itemNum int) []*PushItem {
 	return result
 }
 
+// delPushItem removes a finished order. The caller holds the lock.
 func (p *PushManager) delPushItem(key *PushItem) {
-	defer p.mutex.Unlock()
+	if p.items.Delete(key) == nil {
+		log.WithFields(log.Fields{"orderId": key.Order.OrderId, "userId": key.UserId}).Error("[PushManager.delPushItem] order not found")
+	}
 }
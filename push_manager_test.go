@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	. "gopkg.in/check.v1"
+)
+
+var _ = Suite(&PushManagerSuite{})
+
+type PushManagerSuite struct{}
+
+// Test_delPushItem_sameDate removes every one of several orders sharing a date.
+func (p *PushManagerSuite) Test_delPushItem_sameDate(c *C) {
+	manager := NewPushManager(testGobalDbName, testGobalCollName)
+	items := make([]*PushItem, 0, 6)
+	for i := 0; i < 6; i++ {
+		order := &Order{OrderId: fmt.Sprintf("order-%v", i), Date: 100, Fans: 1}
+		item := &PushItem{order, fmt.Sprintf("%09d", i%3)}
+		manager.Add(context.Background(), item)
+		items = append(items, item)
+	}
+	c.Assert(manager.Len(), Equals, len(items))
+
+	for i, item := range items {
+		manager.lock(context.Background())
+		manager.delPushItem(item)
+		manager.unlock()
+		c.Assert(manager.Len(), Equals, len(items)-i-1)
+	}
+}
+
+func (p *PushManagerSuite) Test_Less(c *C) {
+	a := PushItem{&Order{OrderId: "b", Date: 1}, "2"}
+	c.Assert(a.Less(&PushItem{&Order{OrderId: "a", Date: 2}, "1"}), Equals, true)
+	c.Assert(a.Less(&PushItem{&Order{OrderId: "a", Date: 1}, "3"}), Equals, true)
+	c.Assert(a.Less(&PushItem{&Order{OrderId: "c", Date: 1}, "2"}), Equals, true)
+	c.Assert(a.Less(&PushItem{&Order{OrderId: "b", Date: 1}, "2"}), Equals, false)
+	c.Assert(a.Less(&PushItem{&Order{OrderId: "a", Date: 1}, "2"}), Equals, false)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	RateLimiterIdleTimeout   = 10 * time.Minute
+	RateLimiterCleanInterval = time.Minute
+	RateLimiterMaxBuckets    = 1 << 17
+)
+
+// RateLimitConfig limits the requests of one operation, over all its routes. Rates are
+// requests per second, a rate of 0 disables that limit, and a burst of 0 means the rate
+// rounded up.
+type RateLimitConfig struct {
+	PerUser      float64 `yaml:"per_user"`
+	PerUserBurst int     `yaml:"per_user_burst"`
+	PerIP        float64 `yaml:"per_ip"`
+	PerIPBurst   int     `yaml:"per_ip_burst"`
+}
+
+type TokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func NewTokenBucket(rate float64, burst int, now time.Time) *TokenBucket {
+	b := float64(burst)
+	if b <= 0 {
+		b = math.Ceil(rate)
+	}
+
+	return &TokenBucket{rate: rate, burst: b, tokens: b, last: now}
+}
+
+// Take takes one token, or returns how long to wait until one is available.
+func (p *TokenBucket) Take(now time.Time) (bool, time.Duration) {
+	p.tokens = math.Min(p.burst, p.tokens+now.Sub(p.last).Seconds()*p.rate)
+	p.last = now
+
+	if p.tokens >= 1 {
+		p.tokens--
+		return true, 0
+	}
+
+	wait := (1 - p.tokens) / p.rate
+	return false, time.Duration(wait * float64(time.Second))
+}
+
+// RateLimiter keeps one token bucket per key, and forgets the buckets idle for
+// RateLimiterIdleTimeout. It keeps at most maxBuckets, dropping an arbitrary bucket for a
+// new one when full.
+type RateLimiter struct {
+	mutex      sync.Mutex
+	buckets    map[string]*TokenBucket
+	maxBuckets int
+	now        func() time.Time
+}
+
+var gobalRateLimiter = NewRateLimiter(time.Now)
+
+func NewRateLimiter(now func() time.Time) *RateLimiter {
+	return &RateLimiter{buckets: make(map[string]*TokenBucket), maxBuckets: RateLimiterMaxBuckets, now: now}
+}
+
+func (p *RateLimiter) Allow(key string, rate float64, burst int) (bool, time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	now := p.now()
+	bucket, ok := p.buckets[key]
+	if !ok {
+		if len(p.buckets) >= p.maxBuckets {
+			p.clean(now)
+			for k := range p.buckets {
+				if len(p.buckets) < p.maxBuckets {
+					break
+				}
+				delete(p.buckets, k)
+			}
+		}
+
+		bucket = NewTokenBucket(rate, burst, now)
+		p.buckets[key] = bucket
+	}
+
+	return bucket.Take(now)
+}
+
+func (p *RateLimiter) Clean() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.clean(p.now())
+}
+
+func (p *RateLimiter) clean(now time.Time) {
+	for key, bucket := range p.buckets {
+		if now.Sub(bucket.last) > RateLimiterIdleTimeout {
+			delete(p.buckets, key)
+		}
+	}
+}
+
+func (p *RateLimiter) Len() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return len(p.buckets)
+}
+
+// Check takes a token of userId and one of ip for operation, and returns ERROR_RATE_LIMITED
+// with the wait until the next token when either exceeds limit. Only a userId passing the
+// userid rule has a bucket, so that made up userIds do not fill the limiter.
+func (p *RateLimiter) Check(operation string, limit RateLimitConfig, userId string, ip string) (time.Duration, error) {
+	if limit.PerUser > 0 && len(userId) == currentConfig().UserIdLen {
+		if ok, wait := p.Allow(operation+"|user|"+userId, limit.PerUser, limit.PerUserBurst); !ok {
+			return wait, NewError(ERROR_RATE_LIMITED, "[RateLimiter.Check] too many requests of user. operation=%v userId=%v", operation, userId)
+		}
+	}
+
+	if limit.PerIP > 0 {
+		if ok, wait := p.Allow(operation+"|ip|"+ip, limit.PerIP, limit.PerIPBurst); !ok {
+			return wait, NewError(ERROR_RATE_LIMITED, "[RateLimiter.Check] too many requests of ip. operation=%v ip=%v", operation, ip)
+		}
+	}
+
+	return 0, nil
+}
+
+func startRateLimiterCleaner() {
+	go func() {
+		for range time.Tick(RateLimiterCleanInterval) {
+			gobalRateLimiter.Clean()
+		}
+	}()
+}
+
+// routeRateLimit returns the limit of operation in route_rate_limits, or else rate_limit.
+func routeRateLimit(operation string) RateLimitConfig {
+	for route, limit := range gobalConfig.RouteRateLimits {
+		if operationOf(route) == operation {
+			return limit
+		}
+	}
+
+	return gobalConfig.RateLimit
+}
+
+// rateLimiting rejects the request with ERROR_RATE_LIMITED and a Retry-After header when
+// its userId or client ip exceeds the limit of operation. The routes of an operation share
+// their buckets.
+func rateLimiting(limiter *RateLimiter, operation string) Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		limit := routeRateLimit(operation)
+		if limit.PerUser <= 0 && limit.PerIP <= 0 {
+			return fn
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			r.ParseForm()
+
+			if wait, err := limiter.Check(operation, limit, r.Form.Get("userId"), clientIP(r)); err != nil {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				writeError(w, r, err)
+				return
+			}
+
+			fn(w, r)
+		}
+	}
+}
+
+func validateRateLimit(name string, limit RateLimitConfig) []string {
+	var problems []string
+	if limit.PerUser < 0 || limit.PerIP < 0 {
+		problems = append(problems, fmt.Sprintf("%v: rates must not be negative", name))
+	}
+	if limit.PerUserBurst < 0 || limit.PerIPBurst < 0 {
+		problems = append(problems, fmt.Sprintf("%v: bursts must not be negative", name))
+	}
+
+	return problems
+}
+
+// validateRouteRateLimits checks the limits of route_rate_limits, keyed by the path or the
+// operation of a client route, with one limit per operation.
+func validateRouteRateLimits(limits map[string]RateLimitConfig) []string {
+	routes := make([]string, 0, len(limits))
+	for route := range limits {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+
+	var problems []string
+	operations := make(map[string]string)
+	for _, route := range routes {
+		name := "route_rate_limits." + route
+		if !isClientRoute(route) && !isClientOperation(route) {
+			problems = append(problems, fmt.Sprintf("%v: unknown client route", name))
+			continue
+		}
+		if other, ok := operations[operationOf(route)]; ok {
+			problems = append(problems, fmt.Sprintf("%v: operation %v is already limited by %v", name, operationOf(route), other))
+		}
+		operations[operationOf(route)] = route
+
+		problems = append(problems, validateRateLimit(name, limits[route])...)
+	}
+
+	return problems
+}
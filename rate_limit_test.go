@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+)
+
+var _ = Suite(&RateLimitSuite{})
+
+type RateLimitSuite struct {
+	now time.Time
+}
+
+func (p *RateLimitSuite) SetUpTest(c *C) {
+	p.now = time.Unix(1500000000, 0)
+	gobalConfig.UserIdLen = DefaultUserIdLen
+}
+
+func (p *RateLimitSuite) TearDownTest(c *C) {
+	gobalConfig.RouteRateLimits = nil
+}
+
+func (p *RateLimitSuite) serve(handler http.HandlerFunc, target string) int {
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", target, nil))
+	return w.Code
+}
+
+func (p *RateLimitSuite) clock() time.Time {
+	return p.now
+}
+
+func (p *RateLimitSuite) Test_TokenBucket(c *C) {
+	bucket := NewTokenBucket(2, 3, p.now)
+
+	for i := 0; i < 3; i++ {
+		ok, _ := bucket.Take(p.now)
+		c.Assert(ok, Equals, true)
+	}
+
+	ok, wait := bucket.Take(p.now)
+	c.Assert(ok, Equals, false)
+	c.Assert(wait, Equals, 500*time.Millisecond)
+
+	ok, _ = bucket.Take(p.now.Add(500 * time.Millisecond))
+	c.Assert(ok, Equals, true)
+}
+
+func (p *RateLimitSuite) Test_RateLimiter_Clean(c *C) {
+	limiter := NewRateLimiter(p.clock)
+	limiter.Allow("a", 1, 1)
+
+	p.now = p.now.Add(RateLimiterIdleTimeout + time.Second)
+	limiter.Clean()
+	c.Assert(len(limiter.buckets), Equals, 0)
+}
+
+func (p *RateLimitSuite) Test_rateLimiting_perUser(c *C) {
+	gobalConfig.RouteRateLimits = map[string]RateLimitConfig{"/test": {PerUser: 1, PerUserBurst: 1}}
+
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, rateLimiting(NewRateLimiter(p.clock), "test"))
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/test?userId=000000001", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/test?userId=000000002", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest("GET", "/test?userId=000000001", nil))
+	c.Assert(w.Code, Equals, http.StatusTooManyRequests)
+	c.Assert(w.Header().Get("Retry-After"), Equals, "1")
+
+	var e FollowerError
+	c.Assert(json.Unmarshal(w.Body.Bytes(), &e), IsNil)
+	c.Assert(e.Code, Equals, ERROR_RATE_LIMITED)
+}
+
+func (p *RateLimitSuite) Test_rateLimiting_sharedByOperation(c *C) {
+	gobalConfig.RouteRateLimits = map[string]RateLimitConfig{"coins": {PerUser: 1, PerUserBurst: 1}}
+
+	limiter := NewRateLimiter(p.clock)
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	v1 := Decorate(ok, rateLimiting(limiter, operationOf("/getfollowers/coins")))
+	v2 := Decorate(ok, rateLimiting(limiter, operationOf("/v2/coins")))
+
+	c.Assert(p.serve(v1, "/getfollowers/coins?userId=000000001"), Equals, http.StatusOK)
+	c.Assert(p.serve(v2, "/v2/coins?userId=000000001"), Equals, http.StatusTooManyRequests)
+}
+
+func (p *RateLimitSuite) Test_rateLimiting_invalidUserIdNotKept(c *C) {
+	gobalConfig.RouteRateLimits = map[string]RateLimitConfig{"coins": {PerUser: 1, PerUserBurst: 1}}
+
+	limiter := NewRateLimiter(p.clock)
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}, rateLimiting(limiter, "coins"))
+
+	p.serve(handler, "/v2/coins?userId=1")
+	p.serve(handler, "/v2/coins?userId="+strings.Repeat("x", 1000))
+	c.Assert(limiter.Len(), Equals, 0)
+}
+
+func (p *RateLimitSuite) Test_RateLimiter_maxBuckets(c *C) {
+	limiter := NewRateLimiter(p.clock)
+	limiter.maxBuckets = 2
+
+	limiter.Allow("a", 1, 1)
+	limiter.Allow("b", 1, 1)
+	limiter.Allow("c", 1, 1)
+	c.Assert(limiter.Len(), Equals, 2)
+
+	// the idle buckets go first.
+	p.now = p.now.Add(RateLimiterIdleTimeout + time.Second)
+	limiter.Allow("d", 1, 1)
+	c.Assert(limiter.Len(), Equals, 1)
+}
+
+func (p *RateLimitSuite) Test_validateRouteRateLimits(c *C) {
+	problems := validateRouteRateLimits(map[string]RateLimitConfig{
+		"/getfollowers/getuser": {PerUser: 1},
+		"/v2/getuser":           {PerUser: 1},
+		"/v2/nope":              {PerUser: 1},
+		"coins":                 {PerIP: -1},
+	})
+
+	c.Assert(problems, DeepEquals, []string{
+		"route_rate_limits./v2/getuser: operation getuser is already limited by /getfollowers/getuser",
+		"route_rate_limits./v2/nope: unknown client route",
+		"route_rate_limits.coins: rates must not be negative",
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"gopkg.in/mgo.v2"
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// RetryConfig retries the idempotent mongodb reads up to MaxAttempts times in all, waiting a
+// random delay up to BaseDelay doubled per attempt and capped at MaxDelay. MaxAttempts of 1
+// disables the retries.
+type RetryConfig struct {
+	MaxAttempts int           `yaml:"max_attempts"`
+	BaseDelay   time.Duration `yaml:"base_delay"`
+	MaxDelay    time.Duration `yaml:"max_delay"`
+}
+
+var gobalDbRetries int64
+
+// isDbFailure reports whether err means mongodb is unhealthy, as opposed to an answer of
+// a healthy server such as not found or a duplicate key.
+func isDbFailure(err error) bool {
+	if err == nil || err == mgo.ErrNotFound || mgo.IsDup(err) {
+		return false
+	}
+
+	switch err.(type) {
+	case *mgo.QueryError, *mgo.LastError:
+		return false
+	}
+
+	return true
+}
+
+// dbDo runs the mongodb operation op and records its result in the circuit breaker, unless
+// the deadline of ctx cut it short, which tells nothing about the health of mongodb.
+func dbDo(ctx context.Context, op func() error) error {
+	err := op()
+	if ctx.Err() == nil {
+		gobalDbBreaker.Record(err)
+	}
+	return err
+}
+
+// dbRetry runs the idempotent mongodb read op like dbDo, and retries it on failure while
+// the breaker allows and the deadline of ctx is not passed. session is refreshed between
+// the attempts to drop a broken socket, and its timeouts bounded by the time left.
+func dbRetry(ctx context.Context, session *mgo.Session, op func() error) error {
+	retry := currentConfig().DbRetry
+
+	err := dbDo(ctx, op)
+	for attempt := 1; attempt < retry.MaxAttempts && isDbFailure(err); attempt++ {
+		timer := time.NewTimer(backoff(retry, attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+
+		if ctx.Err() != nil || !gobalDbBreaker.Allow() {
+			return err
+		}
+
+		atomic.AddInt64(&gobalDbRetries, 1)
+		requestLogger(ctx).Warnf("[dbRetry] retry mongodb read. attempt=%v error=%v", attempt+1, err)
+		session.Refresh()
+		setDbTimeouts(ctx, session)
+		err = dbDo(ctx, op)
+	}
+
+	return err
+}
+
+// backoff returns the full jitter delay before the given retry attempt.
+func backoff(retry RetryConfig, attempt int) time.Duration {
+	ceiling := retry.MaxDelay
+	if attempt < 32 && retry.BaseDelay<<uint(attempt-1) < ceiling {
+		ceiling = retry.BaseDelay << uint(attempt-1)
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+func validateRetry(retry RetryConfig) []string {
+	var problems []string
+	if retry.MaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("db_retry.max_attempts must be at least 1, got %v", retry.MaxAttempts))
+	}
+	if retry.BaseDelay < 0 || retry.MaxDelay < retry.BaseDelay {
+		problems = append(problems, fmt.Sprintf("db_retry: base_delay %v must not be negative or above max_delay %v", retry.BaseDelay, retry.MaxDelay))
+	}
+
+	return problems
+}
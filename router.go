@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Route is one route of the client api.
+type Route struct {
+	// Method is empty for the v1 routes, which accept any method.
+	Method  string
+	Path    string
+	Handler HandlerFunc
+
+	// Versions overrides Handler for some values of the version parameter, see versioned.
+	Versions map[int64]HandlerFunc
+
+	// Request is the request struct of the route, see ParamSpec. Nil if it takes no
+	// parameter.
+	Request interface{}
+
+	// Response is the response struct of the route, documented by the openapi document.
+	Response interface{}
+
+	// Write marks the routes which change data. They honour the Idempotency-Key header.
+	Write bool
+
+	// Static marks the routes which serve a fixed document from memory. They are neither
+	// rate limited nor closed by maintenance, see clientDecorators.
+	Static bool
+}
+
+// Operation names the operation of the route, the last segment of its path. The v1 and v2
+// routes of an operation, and its grpc method, share its maintenance and rate limits.
+func (p Route) Operation() string {
+	return operationOf(p.Path)
+}
+
+// operationOf returns the last segment of path in lower case, e.g. buyfollower for
+// /v2/buyfollower.
+func operationOf(path string) string {
+	return strings.ToLower(path[strings.LastIndex(path, "/")+1:])
+}
+
+// Router dispatches by path and method. It answers ERROR_METHOD_NOT_ALLOWED with an Allow
+// header for a known path with another method, and ERROR_ROUTE_NOT_FOUND for an unknown path.
+type Router struct {
+	routes map[string]map[string]http.HandlerFunc
+}
+
+func NewRouter() *Router {
+	return &Router{routes: make(map[string]map[string]http.HandlerFunc)}
+}
+
+func (p *Router) Handle(method string, path string, fn http.HandlerFunc) {
+	if p.routes[path] == nil {
+		p.routes[path] = make(map[string]http.HandlerFunc)
+	}
+	p.routes[path][method] = fn
+}
+
+func (p *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	methods, ok := p.routes[r.URL.Path]
+	if !ok {
+		writeError(w, r, NewError(ERROR_ROUTE_NOT_FOUND, "[Router.ServeHTTP] unknown route. path=%v", r.URL.Path))
+		return
+	}
+
+	fn, ok := methods[r.Method]
+	if !ok && r.Method == http.MethodHead {
+		fn, ok = methods[http.MethodGet]
+	}
+	if !ok {
+		w.Header().Set("Allow", strings.Join(p.allowed(r.URL.Path), ", "))
+		writeError(w, r, NewError(ERROR_METHOD_NOT_ALLOWED, "[Router.ServeHTTP] method not allowed. method=%v path=%v", r.Method, r.URL.Path))
+		return
+	}
+
+	fn(w, r)
+}
+
+func (p *Router) allowed(path string) []string {
+	allowed := make([]string, 0, len(p.routes[path]))
+	for method := range p.routes[path] {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+
+	return allowed
+}
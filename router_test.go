@@ -0,0 +1,114 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+)
+
+var _ = Suite(&RouterSuite{})
+
+type RouterSuite struct{}
+
+func (p *RouterSuite) SetUpTest(c *C) {
+	gobalConfig.UserIdLen = DefaultUserIdLen
+}
+
+func (p *RouterSuite) router() *Router {
+	router := NewRouter()
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+	router.Handle(http.MethodPost, "/v2/coins", ok)
+	router.Handle(http.MethodGet, "/v2/info", ok)
+	router.Handle(http.MethodPut, "/v2/info", ok)
+
+	return router
+}
+
+func (p *RouterSuite) Test_ServeHTTP(c *C) {
+	w := httptest.NewRecorder()
+	p.router().ServeHTTP(w, httptest.NewRequest("POST", "/v2/coins", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	w = httptest.NewRecorder()
+	p.router().ServeHTTP(w, httptest.NewRequest("HEAD", "/v2/info", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+}
+
+func (p *RouterSuite) Test_ServeHTTP_methodNotAllowed(c *C) {
+	w := httptest.NewRecorder()
+	p.router().ServeHTTP(w, httptest.NewRequest("DELETE", "/v2/info", nil))
+
+	c.Assert(w.Code, Equals, http.StatusMethodNotAllowed)
+	c.Assert(w.Header().Get("Allow"), Equals, "GET, PUT")
+	c.Assert(strings.Contains(w.Body.String(), "method not allowed"), Equals, true)
+}
+
+func (p *RouterSuite) Test_ServeHTTP_notFound(c *C) {
+	w := httptest.NewRecorder()
+	p.router().ServeHTTP(w, httptest.NewRequest("GET", "/v2/nope", nil))
+
+	c.Assert(w.Code, Equals, http.StatusNotFound)
+	c.Assert(w.Header().Get("Allow"), Equals, "")
+}
+
+func (p *RouterSuite) jsonBodyHandler(req *BuyFollowerRequestV2, form *url.Values) http.HandlerFunc {
+	return Decorate(func(w http.ResponseWriter, r *http.Request) {
+		if err := bodyRequest(r, req); err != nil {
+			writeError(w, r, err)
+			return
+		}
+		r.ParseForm()
+		*form = r.Form
+		w.WriteHeader(http.StatusOK)
+	}, jsonBody(Route{Method: http.MethodPost, Path: "/v2/buyfollower", Request: BuyFollowerRequestV2{}}))
+}
+
+func (p *RouterSuite) post(handler http.HandlerFunc, target string, contentType string, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", target, strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func (p *RouterSuite) Test_jsonBody(c *C) {
+	var req BuyFollowerRequestV2
+	var form url.Values
+	handler := p.jsonBodyHandler(&req, &form)
+
+	w := p.post(handler, "/v2/buyfollower?app=likes&coins=99", "application/json; charset=utf-8", `{"userId": "000000001", "coins": 10, "value": 2}`)
+	c.Assert(w.Code, Equals, http.StatusOK)
+	c.Assert(req, Equals, BuyFollowerRequestV2{UserId: "000000001", Coins: 10, Value: 2})
+
+	// the url parameters of the request are ignored, app and lang are kept.
+	c.Assert(form, DeepEquals, url.Values{"userId": {"000000001"}, "coins": {"10"}, "value": {"2"}, "app": {"likes"}})
+}
+
+func (p *RouterSuite) Test_jsonBody_invalid(c *C) {
+	var req BuyFollowerRequestV2
+	var form url.Values
+	handler := p.jsonBodyHandler(&req, &form)
+
+	for _, body := range []string{
+		`{"userId": "000000001", "coins": "10", "value": 2}`,
+		`{"userId": "000000001", "coins": 10, "value": null}`,
+		`{"userId": "000000001", "coins": 10, "value": 2, "extra": true}`,
+		`[1, 2]`,
+		``,
+	} {
+		w := p.post(handler, "/v2/buyfollower", "application/json", body)
+		c.Assert(w.Code, Equals, http.StatusBadRequest, Commentf(body))
+	}
+
+	w := p.post(handler, "/v2/buyfollower?userId=000000001&coins=10&value=2", "", "")
+	c.Assert(w.Code, Equals, http.StatusUnsupportedMediaType)
+	w = p.post(handler, "/v2/buyfollower", "application/x-www-form-urlencoded", "userId=000000001&coins=10&value=2")
+	c.Assert(w.Code, Equals, http.StatusUnsupportedMediaType)
+}
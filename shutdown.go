@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+const (
+	AdminShutdownTimeout = 5 * time.Second
+	TraceFlushTimeout    = 5 * time.Second
+)
+
+var gobalDraining int32
+
+func isDraining() bool {
+	return atomic.LoadInt32(&gobalDraining) == 1
+}
+
+// notifySignals queues SIGINT, SIGTERM and SIGHUP for waitForShutdown. main calls it before
+// it starts the listeners and loads the orders, so that a signal meanwhile is not fatal.
+func notifySignals() <-chan os.Signal {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	return signals
+}
+
+// waitForShutdown reloads the config on SIGHUP, and blocks until SIGINT or SIGTERM, then
+// shuts the server down gracefully.
+func waitForShutdown(signals <-chan os.Signal) {
+	for sig := range signals {
+		if sig == syscall.SIGHUP {
+			log.Info("receive SIGHUP, reloading config")
+			if err := reloadConfig(); err != nil {
+				log.Errorf("[waitForShutdown] SIGHUP reload failed. error=%v", err)
+			}
+			continue
+		}
+
+		log.Infof("receive signal, shutting down. signal=%v", sig)
+		shutdown()
+		return
+	}
+}
+
+// shutdown marks the server as draining, so that /readyz fails, and keeps serving for
+// ShutdownDelay while the load balancers take the instance out. It then stops accepting
+// connections and waits up to ShutdownTimeout for the in-flight http requests (including a
+// running PushManager.push bulk update), and as long again for the grpc calls. The admin
+// listener and the trace flush have budgets of their own, so that a slow drain does not
+// cut them short. It finally logs the counters and closes the mongodb session.
+func shutdown() {
+	atomic.StoreInt32(&gobalDraining, 1)
+
+	if gobalConfig.ShutdownDelay > 0 {
+		log.Infof("draining, shutting down in %v", gobalConfig.ShutdownDelay)
+		time.Sleep(gobalConfig.ShutdownDelay)
+	}
+
+	shutdownStage("drain http requests", gobalConfig.ShutdownTimeout, gobalHttpServer.Shutdown)
+	if gobalGrpcServer != nil {
+		shutdownStage("drain grpc calls", gobalConfig.ShutdownTimeout, stopGrpc)
+	}
+	if gobalAdminServer != nil {
+		shutdownStage("close admin listener", AdminShutdownTimeout, gobalAdminServer.Shutdown)
+	}
+
+	log.WithFields(log.Fields{
+		"request":    gobalCounter.Request(),
+		"latency":    gobalCounter.Latency(),
+		"aveLatency": gobalCounter.AveLatency(),
+	}).Info("final counter")
+
+	if gobalTracerProvider != nil {
+		shutdownStage("flush traces", TraceFlushTimeout, gobalTracerProvider.Shutdown)
+	}
+
+	if gobalMgoSession != nil {
+		gobalMgoSession.Close()
+	}
+
+	log.Info("shutdown finished")
+}
+
+// shutdownStage runs stop with a budget of timeout.
+func shutdownStage(name string, timeout time.Duration, stop func(ctx context.Context) error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := stop(ctx); err != nil {
+		log.Errorf("[shutdown] %v failed. error=%v", name, err)
+		return
+	}
+	log.Infof("%v finished", name)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+var _ = Suite(&ShutdownSuite{})
+
+type ShutdownSuite struct{}
+
+func (p *ShutdownSuite) SetUpTest(c *C) {
+	gobalApps = NewAppRegistry(Config{})
+	gobalConfig.ShutdownDelay = 0
+	gobalConfig.ShutdownTimeout = time.Second
+}
+
+func (p *ShutdownSuite) TearDownTest(c *C) {
+	atomic.StoreInt32(&gobalDraining, 0)
+	gobalHttpServer, gobalAdminServer = nil, nil
+}
+
+// serve serves handler on a local port, and returns the server and its url.
+func (p *ShutdownSuite) serve(c *C, handler http.HandlerFunc) (*http.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	return server, "http://" + listener.Addr().String()
+}
+
+func (p *ShutdownSuite) Test_shutdown_delay(c *C) {
+	gobalConfig.ShutdownDelay = 200 * time.Millisecond
+	var url string
+	gobalHttpServer, url = p.serve(c, func(w http.ResponseWriter, r *http.Request) {})
+
+	done := make(chan struct{})
+	go func() {
+		shutdown()
+		close(done)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	// draining and not ready, but still serving.
+	c.Assert(isDraining(), Equals, true)
+	w := httptest.NewRecorder()
+	readyzHandler(w, httptest.NewRequest("GET", "/readyz", nil))
+	c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+	resp, err := http.Get(url)
+	c.Assert(err, IsNil)
+	resp.Body.Close()
+
+	<-done
+	_, err = http.Get(url)
+	c.Assert(err, NotNil)
+}
+
+func (p *ShutdownSuite) Test_shutdown_budgets(c *C) {
+	gobalConfig.ShutdownTimeout = 50 * time.Millisecond
+	release := make(chan struct{})
+	defer close(release)
+	var url, adminUrl string
+	gobalHttpServer, url = p.serve(c, func(w http.ResponseWriter, r *http.Request) { <-release })
+
+	var adminFinished int32
+	gobalAdminServer, adminUrl = p.serve(c, func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(150 * time.Millisecond)
+		atomic.StoreInt32(&adminFinished, 1)
+	})
+
+	go http.Get(url)
+	go http.Get(adminUrl)
+	time.Sleep(20 * time.Millisecond)
+
+	// the http drain runs out of time, and the admin listener still waits for its request.
+	start := time.Now()
+	shutdown()
+	c.Assert(time.Since(start) >= gobalConfig.ShutdownTimeout, Equals, true)
+	c.Assert(atomic.LoadInt32(&adminFinished), Equals, int32(1))
+}
+
+// Test_notifySignals queues a signal sent before waitForShutdown runs.
+func (p *ShutdownSuite) Test_notifySignals(c *C) {
+	signals := notifySignals()
+	defer signal.Reset(syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+
+	c.Assert(syscall.Kill(syscall.Getpid(), syscall.SIGHUP), IsNil)
+	select {
+	case sig := <-signals:
+		c.Assert(sig, Equals, syscall.SIGHUP)
+	case <-time.After(time.Second):
+		c.Fatal("SIGHUP not queued")
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// CertReloader serves the certificate of cert_file and key_file, and loads it again when
+// either file changes or Reload is called.
+type CertReloader struct {
+	mutex    sync.RWMutex
+	cert     *tls.Certificate
+	certFile string
+	keyFile  string
+	modTime  time.Time
+}
+
+var gobalCertReloader *CertReloader
+
+func NewCertReloader() (*CertReloader, error) {
+	p := &CertReloader{}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// Reload loads the certificate from the currently configured paths. The old certificate
+// stays in use if loading fails.
+func (p *CertReloader) Reload() error {
+	cfg := currentConfig()
+	cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("load certificate failed. certFile=%v keyFile=%v error=%v", cfg.CertFile, cfg.KeyFile, err)
+	}
+
+	p.mutex.Lock()
+	p.cert = &cert
+	p.certFile = cfg.CertFile
+	p.keyFile = cfg.KeyFile
+	p.modTime = latestModTime(cfg.CertFile, cfg.KeyFile)
+	p.mutex.Unlock()
+
+	log.Infof("certificate loaded. certFile=%v keyFile=%v", cfg.CertFile, cfg.KeyFile)
+	return nil
+}
+
+func (p *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	return p.cert, nil
+}
+
+// Watch reloads the certificate whenever the modification time of its files changes.
+func (p *CertReloader) Watch(interval time.Duration) {
+	go func() {
+		for range time.Tick(interval) {
+			p.mutex.RLock()
+			changed := latestModTime(p.certFile, p.keyFile).After(p.modTime)
+			p.mutex.RUnlock()
+
+			if changed {
+				if err := p.Reload(); err != nil {
+					log.Errorf("[CertReloader.Watch] %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func latestModTime(files ...string) time.Time {
+	var latest time.Time
+	for _, file := range files {
+		if info, err := os.Stat(file); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest
+}
+
+// initTLS loads the certificate shared by the client listener and, when client_ca_file is
+// set, the admin listener.
+func initTLS() {
+	if !gobalConfig.TLS && gobalConfig.ClientCAFile == "" {
+		return
+	}
+
+	reloader, err := NewCertReloader()
+	if err != nil {
+		log.Errorf("[initTLS] %v", err)
+		os.Exit(1)
+	}
+	gobalCertReloader = reloader
+	if gobalConfig.CertReloadInterval > 0 {
+		reloader.Watch(gobalConfig.CertReloadInterval)
+	}
+}
+
+// newTLSConfig builds a tls config serving the reloaded certificate. With verifyClients,
+// client certificates are verified against client_ca_file if given, and required by
+// requireClientCert.
+func newTLSConfig(verifyClients bool) *tls.Config {
+	tlsConfig := &tls.Config{
+		MinVersion:     tlsVersions[gobalConfig.TLSMinVersion],
+		GetCertificate: gobalCertReloader.GetCertificate,
+	}
+
+	if len(gobalConfig.TLSCipherSuites) != 0 {
+		suites, err := parseCipherSuites(gobalConfig.TLSCipherSuites)
+		if err != nil {
+			log.Errorf("[newTLSConfig] %v", err)
+			os.Exit(1)
+		}
+		tlsConfig.CipherSuites = suites
+	}
+
+	if verifyClients {
+		pool, err := loadCertPool(gobalConfig.ClientCAFile)
+		if err != nil {
+			log.Errorf("[initTLS] %v", err)
+			os.Exit(1)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return tlsConfig
+}
+
+func parseCipherSuites(names []string) ([]uint16, error) {
+	known := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		known[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown or insecure cipher suite %v", name)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read client ca file failed. file=%v error=%v", file, err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in client ca file. file=%v", file)
+	}
+
+	return pool, nil
+}
+
+func validateTLS(cfg Config) []string {
+	var problems []string
+	if !cfg.TLS && cfg.ClientCAFile == "" {
+		return problems
+	}
+
+	if !fileExists(cfg.CertFile) {
+		problems = append(problems, fmt.Sprintf("cert_file %v does not exist", cfg.CertFile))
+	}
+	if !fileExists(cfg.KeyFile) {
+		problems = append(problems, fmt.Sprintf("key_file %v does not exist", cfg.KeyFile))
+	}
+	if _, ok := tlsVersions[cfg.TLSMinVersion]; !ok {
+		problems = append(problems, fmt.Sprintf("tls_min_version must be one of 1.0, 1.1, 1.2, 1.3, got %q", cfg.TLSMinVersion))
+	}
+	if _, err := parseCipherSuites(cfg.TLSCipherSuites); err != nil {
+		problems = append(problems, fmt.Sprintf("tls_cipher_suites: %v", err))
+	}
+	if cfg.ClientCAFile != "" && !fileExists(cfg.ClientCAFile) {
+		problems = append(problems, fmt.Sprintf("client_ca_file %v does not exist", cfg.ClientCAFile))
+	}
+	if cfg.CertReloadInterval < 0 {
+		problems = append(problems, fmt.Sprintf("cert_reload_interval must not be negative, got %v", cfg.CertReloadInterval))
+	}
+
+	return problems
+}
+
+// requireClientCert rejects requests without a client certificate verified against
+// client_ca_file. It does nothing if client_ca_file is not set.
+func requireClientCert() Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		if gobalConfig.ClientCAFile == "" {
+			return fn
+		}
+
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				writeError(w, r, NewError(ERROR_CLIENT_CERT_REQUIRED, "[requireClientCert] no verified client certificate. path=%v clientIp=%v", r.URL.Path, clientIP(r)))
+				return
+			}
+
+			fn(w, r)
+		}
+	}
+}
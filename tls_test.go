@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	. "gopkg.in/check.v1"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"time"
+)
+
+var _ = Suite(&TLSSuite{})
+
+type TLSSuite struct {
+	dir string
+}
+
+func (p *TLSSuite) SetUpTest(c *C) {
+	p.dir = c.MkDir()
+	gobalConfig.CertFile = filepath.Join(p.dir, "server.crt")
+	gobalConfig.KeyFile = filepath.Join(p.dir, "server.key")
+}
+
+func (p *TLSSuite) TearDownTest(c *C) {
+	gobalConfig.ClientCAFile = ""
+}
+
+// writeCert writes a self-signed certificate for commonName to cert_file and key_file.
+func (p *TLSSuite) writeCert(c *C, commonName string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, IsNil)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	c.Assert(err, IsNil)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	c.Assert(err, IsNil)
+
+	c.Assert(ioutil.WriteFile(gobalConfig.CertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600), IsNil)
+	c.Assert(ioutil.WriteFile(gobalConfig.KeyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600), IsNil)
+}
+
+// servedName returns the common name of the certificate served by reloader.
+func (p *TLSSuite) servedName(c *C, reloader *CertReloader) string {
+	cert, err := reloader.GetCertificate(&tls.ClientHelloInfo{})
+	c.Assert(err, IsNil)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	c.Assert(err, IsNil)
+
+	return leaf.Subject.CommonName
+}
+
+func (p *TLSSuite) Test_CertReloader_Reload(c *C) {
+	p.writeCert(c, "one.example.com")
+	reloader, err := NewCertReloader()
+	c.Assert(err, IsNil)
+	c.Assert(p.servedName(c, reloader), Equals, "one.example.com")
+
+	p.writeCert(c, "two.example.com")
+	c.Assert(reloader.Reload(), IsNil)
+	c.Assert(p.servedName(c, reloader), Equals, "two.example.com")
+
+	// a broken pair keeps the old certificate in use.
+	c.Assert(ioutil.WriteFile(gobalConfig.KeyFile, []byte("broken"), 0600), IsNil)
+	c.Assert(reloader.Reload(), NotNil)
+	c.Assert(p.servedName(c, reloader), Equals, "two.example.com")
+}
+
+func (p *TLSSuite) Test_NewCertReloader_missing(c *C) {
+	_, err := NewCertReloader()
+	c.Assert(err, NotNil)
+}
+
+func (p *TLSSuite) Test_validateTLS(c *C) {
+	c.Assert(validateTLS(Config{CertFile: "missing.crt"}), HasLen, 0)
+
+	p.writeCert(c, "one.example.com")
+	c.Assert(validateTLS(Config{TLS: true, CertFile: gobalConfig.CertFile, KeyFile: gobalConfig.KeyFile, TLSMinVersion: "1.2",
+		TLSCipherSuites: []string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"}}), HasLen, 0)
+
+	problems := validateTLS(Config{TLS: true, CertFile: "missing.crt", KeyFile: gobalConfig.KeyFile, TLSMinVersion: "1.4",
+		TLSCipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}, ClientCAFile: "missing.pem", CertReloadInterval: -time.Second})
+	c.Assert(problems, DeepEquals, []string{
+		"cert_file missing.crt does not exist",
+		`tls_min_version must be one of 1.0, 1.1, 1.2, 1.3, got "1.4"`,
+		"tls_cipher_suites: unknown or insecure cipher suite TLS_RSA_WITH_RC4_128_SHA",
+		"client_ca_file missing.pem does not exist",
+		"cert_reload_interval must not be negative, got -1s",
+	})
+}
+
+func (p *TLSSuite) Test_requireClientCert(c *C) {
+	handler := func(w http.ResponseWriter, r *http.Request) {}
+
+	w := httptest.NewRecorder()
+	Decorate(handler, requireClientCert())(w, httptest.NewRequest("GET", "/metrics", nil))
+	c.Assert(w.Code, Equals, http.StatusOK)
+
+	gobalConfig.ClientCAFile = "ca.pem"
+	w = httptest.NewRecorder()
+	Decorate(handler, requireClientCert())(w, httptest.NewRequest("GET", "/metrics", nil))
+	c.Assert(w.Code, Equals, http.StatusForbidden)
+
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.TLS = &tls.ConnectionState{}
+	w = httptest.NewRecorder()
+	Decorate(handler, requireClientCert())(w, r)
+	c.Assert(w.Code, Equals, http.StatusForbidden)
+
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{&x509.Certificate{}}}
+	w = httptest.NewRecorder()
+	Decorate(handler, requireClientCert())(w, r)
+	c.Assert(w.Code, Equals, http.StatusOK)
+}
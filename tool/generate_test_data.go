@@ -16,17 +16,19 @@ func generateStatusData(fans int64, progress int64) bool {
 }
 
 var gobalMongoUri string
+var gobalDbName string
+var gobalCollName string
 
 func main() {
 	parseCommandLine()
 
 	session, err := mgo.Dial(gobalMongoUri)
 	if err != nil {
-		fmt.Println("mgo.Dial failed. error=%v", err)
+		fmt.Printf("mgo.Dial failed. error=%v\n", err)
 		os.Exit(1)
 	}
 
-	collection := session.DB("follower").C("user")
+	collection := session.DB(gobalDbName).C(gobalCollName)
 	bulk := collection.Bulk()
 
 	for i := 0; i < 100; i++ {
@@ -54,7 +56,7 @@ func main() {
 
 	_, err = bulk.Run()
 	if err != nil {
-		fmt.Println("bulk.Run failed. error=%v", err)
+		fmt.Printf("bulk.Run failed. error=%v\n", err)
 	} else {
 		fmt.Println("bulk.Run finish")
 	}
@@ -70,9 +72,11 @@ func parseCommandLine() {
 	}
 
 	flag.StringVar(&gobalMongoUri, "mongoUri", "", "mongodb uri. (Required)")
+	flag.StringVar(&gobalDbName, "db_name", "follower", "mongodb database of the app.")
+	flag.StringVar(&gobalCollName, "coll_name", "user", "mongodb collection of users.")
 	flag.Parse()
 
-	if flag.NFlag() != requiredArgs {
+	if gobalMongoUri == "" || flag.NFlag() < requiredArgs {
 		flag.Usage()
 	}
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"gopkg.in/mgo.v2"
+	"net/http"
+	"os"
+)
+
+const (
+	TraceExporterNone   = "none"
+	TraceExporterStdout = "stdout"
+	TraceExporterOtlp   = "otlp"
+
+	TracerName  = "go-web"
+	ServiceName = "follower"
+)
+
+var gobalTracerProvider *sdktrace.TracerProvider
+
+var tracer = otel.Tracer(TracerName)
+
+func initTracing() {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch gobalConfig.TraceExporter {
+	case TraceExporterNone:
+		return
+	case TraceExporterStdout:
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case TraceExporterOtlp:
+		options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(gobalConfig.TraceEndpoint)}
+		if gobalConfig.TraceInsecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	default:
+		err = fmt.Errorf("unknown exporter %v", gobalConfig.TraceExporter)
+	}
+
+	if err != nil {
+		log.Errorf("[initTracing] create trace exporter failed. exporter=%v error=%v", gobalConfig.TraceExporter, err)
+		os.Exit(1)
+	}
+
+	res := resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(ServiceName))
+	gobalTracerProvider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(gobalConfig.TraceSampleRatio))),
+	)
+	otel.SetTracerProvider(gobalTracerProvider)
+
+	log.Infof("tracing enabled. exporter=%v endpoint=%v", gobalConfig.TraceExporter, gobalConfig.TraceEndpoint)
+}
+
+// tracing starts a server span for the request, continuing the W3C trace context of the caller.
+func tracing() Decorator {
+	return func(fn http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method+" "+r.URL.Path,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					semconv.HTTPRequestMethodKey.String(r.Method),
+					semconv.URLPath(r.URL.Path),
+					semconv.ClientAddress(clientIP(r)),
+				))
+			defer span.End()
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			fn(recorder, r.WithContext(ctx))
+
+			span.SetAttributes(semconv.HTTPResponseStatusCode(recorder.Status()))
+			if recorder.Status() >= http.StatusBadRequest {
+				span.SetStatus(codes.Error, http.StatusText(recorder.Status()))
+			}
+		}
+	}
+}
+
+// startDbSpan starts a client span for one mongodb operation on the collection.
+func startDbSpan(ctx context.Context, operation string, collection *mgo.Collection) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "mongo."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemMongoDB,
+			semconv.DBNamespace(collection.Database.Name),
+			semconv.DBCollectionName(collection.Name),
+			semconv.DBOperationName(operation),
+		))
+}
+
+// endSpan records err, if any, on the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil && err != mgo.ErrNotFound {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func traceIdField(ctx context.Context) (string, bool) {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.HasTraceID() {
+		return "", false
+	}
+
+	return spanContext.TraceID().String(), true
+}
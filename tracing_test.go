@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	. "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2"
+	"net/http"
+	"net/http/httptest"
+)
+
+var _ = Suite(&TracingSuite{})
+
+type TracingSuite struct {
+	recorder *tracetest.SpanRecorder
+	seen     int
+}
+
+// SetUpSuite records the spans in memory. The tracer delegates to the first provider set,
+// so the provider is kept for the whole suite.
+func (p *TracingSuite) SetUpSuite(c *C) {
+	p.recorder = tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(p.recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+}
+
+// ended returns the spans ended since the last call.
+func (p *TracingSuite) ended() []sdktrace.ReadOnlySpan {
+	spans := p.recorder.Ended()[p.seen:]
+	p.seen += len(spans)
+	return spans
+}
+
+func attributeOf(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+
+	return attribute.Value{}
+}
+
+func (p *TracingSuite) Test_tracing(c *C) {
+	p.ended()
+	var traceId string
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {
+		traceId, _ = traceIdField(r.Context())
+		w.WriteHeader(http.StatusNotFound)
+	}, tracing())
+
+	r := httptest.NewRequest("GET", "/v2/info?userId=000000001", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	handler(httptest.NewRecorder(), r)
+
+	spans := p.ended()
+	c.Assert(spans, HasLen, 1)
+	span := spans[0]
+	c.Assert(span.Name(), Equals, "GET /v2/info")
+	c.Assert(span.SpanKind(), Equals, trace.SpanKindServer)
+	c.Assert(span.SpanContext().TraceID().String(), Equals, "4bf92f3577b34da6a3ce929d0e0e4736")
+	c.Assert(span.Parent().SpanID().String(), Equals, "00f067aa0ba902b7")
+	c.Assert(traceId, Equals, "4bf92f3577b34da6a3ce929d0e0e4736")
+	c.Assert(attributeOf(span, "url.path").AsString(), Equals, "/v2/info")
+	c.Assert(attributeOf(span, "http.response.status_code").AsInt64(), Equals, int64(http.StatusNotFound))
+	c.Assert(span.Status().Code, Equals, codes.Error)
+}
+
+func (p *TracingSuite) Test_tracing_newTrace(c *C) {
+	p.ended()
+	handler := Decorate(func(w http.ResponseWriter, r *http.Request) {}, tracing())
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/v2/errors", nil))
+
+	spans := p.ended()
+	c.Assert(spans, HasLen, 1)
+	c.Assert(spans[0].Parent().IsValid(), Equals, false)
+	c.Assert(attributeOf(spans[0], "http.response.status_code").AsInt64(), Equals, int64(http.StatusOK))
+	c.Assert(spans[0].Status().Code, Equals, codes.Unset)
+}
+
+func (p *TracingSuite) Test_startDbSpan(c *C) {
+	p.ended()
+	collection := &mgo.Collection{Database: &mgo.Database{Name: "follower"}, Name: "user"}
+	ctx, parent := tracer.Start(context.Background(), "request")
+
+	_, span := startDbSpan(ctx, "find", collection)
+	endSpan(span, mgo.ErrNotFound)
+	_, span = startDbSpan(ctx, "findAndModify", collection)
+	endSpan(span, errors.New("no reachable servers"))
+	parent.End()
+
+	spans := p.ended()
+	c.Assert(spans, HasLen, 3)
+	find, modify := spans[0], spans[1]
+	c.Assert(find.Name(), Equals, "mongo.find")
+	c.Assert(find.SpanKind(), Equals, trace.SpanKindClient)
+	c.Assert(find.Parent().SpanID(), Equals, parent.SpanContext().SpanID())
+	c.Assert(attributeOf(find, "db.system").AsString(), Equals, "mongodb")
+	c.Assert(attributeOf(find, "db.namespace").AsString(), Equals, "follower")
+	c.Assert(attributeOf(find, "db.collection.name").AsString(), Equals, "user")
+	c.Assert(find.Status().Code, Equals, codes.Unset)
+
+	c.Assert(modify.Name(), Equals, "mongo.findAndModify")
+	c.Assert(modify.Status(), Equals, sdktrace.Status{Code: codes.Error, Description: "no reachable servers"})
+	c.Assert(modify.Events(), HasLen, 1)
+}
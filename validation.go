@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Violation is one invalid request parameter.
+type Violation struct {
+	Param  string `json:"param"`
+	Reason string `json:"reason"`
+}
+
+// ParamSpec is the schema of one request parameter, declared on a field of a request
+// struct with the tags
+//
+//	param:"userId"                 the parameter name
+//	validate:"required,min=1"      comma separated rules
+//
+// The rules are required, min=N and max=N for integers, userid for a string of
+// userid_len characters, and version for a version accepted by the VersionRegistry. The field is a string,
+// an int or an int64.
+type ParamSpec struct {
+	Name     string
+	Kind     reflect.Kind
+	Required bool
+	Min      *int64
+	Max      *int64
+	UserId   bool
+	Version  bool
+	field    int
+}
+
+// paramSpecs returns the schema of the request struct type t. It panics on a malformed tag,
+// which is a programming error.
+func paramSpecs(t reflect.Type) []ParamSpec {
+	var specs []ParamSpec
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("param")
+		if name == "" {
+			continue
+		}
+
+		spec := ParamSpec{Name: name, Kind: field.Type.Kind(), field: i}
+		if spec.Kind != reflect.String && spec.Kind != reflect.Int && spec.Kind != reflect.Int64 {
+			panic(fmt.Sprintf("param %v of %v: unsupported type %v", name, t, field.Type))
+		}
+
+		for _, rule := range strings.Split(field.Tag.Get("validate"), ",") {
+			key, value := rule, ""
+			if i := strings.Index(rule, "="); i >= 0 {
+				key, value = rule[:i], rule[i+1:]
+			}
+
+			switch key {
+			case "":
+			case "required":
+				spec.Required = true
+			case "min", "max":
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil || spec.Kind == reflect.String {
+					panic(fmt.Sprintf("param %v of %v: invalid rule %v", name, t, rule))
+				}
+				if key == "min" {
+					spec.Min = &n
+				} else {
+					spec.Max = &n
+				}
+			case "userid":
+				spec.UserId = true
+			case "version":
+				spec.Version = true
+			default:
+				panic(fmt.Sprintf("param %v of %v: unknown rule %v", name, t, rule))
+			}
+		}
+
+		specs = append(specs, spec)
+	}
+
+	return specs
+}
+
+// check parses the raw parameter into v, or returns why it is invalid.
+func (p ParamSpec) check(raw string, v reflect.Value) string {
+	if p.Kind == reflect.String {
+		v.SetString(raw)
+		return p.validate(v)
+	}
+
+	n, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || v.OverflowInt(n) {
+		return "must be an integer"
+	}
+	v.SetInt(n)
+
+	return p.validate(v)
+}
+
+// validate returns why the value v breaks the rules of the spec, if it does.
+func (p ParamSpec) validate(v reflect.Value) string {
+	if p.Kind == reflect.String {
+		if p.UserId && v.Len() != currentConfig().UserIdLen {
+			return fmt.Sprintf("must be %v characters long", currentConfig().UserIdLen)
+		}
+		return ""
+	}
+
+	n := v.Int()
+	if p.Min != nil && n < *p.Min {
+		return fmt.Sprintf("must be at least %v", *p.Min)
+	}
+	if p.Max != nil && n > *p.Max {
+		return fmt.Sprintf("must be at most %v", *p.Max)
+	}
+	if p.Version {
+		versions := currentVersions()
+		if _, err := versions.Resolve(n, time.Now()); err != nil {
+			return fmt.Sprintf("unsupported version, supported versions are %v", versions.Supported(time.Now()))
+		}
+	}
+
+	return ""
+}
+
+// decodeParams fills the request struct pointed to by req from values, following the
+// ParamSpec of its fields, and reports all violations at once as ERROR_URL_PARAM_INVALID.
+func decodeParams(values url.Values, req interface{}) error {
+	v := reflect.ValueOf(req).Elem()
+
+	var violations []Violation
+	for _, spec := range paramSpecs(v.Type()) {
+		raw, ok := values[spec.Name]
+		if !ok || len(raw) == 0 || raw[0] == "" {
+			if spec.Required {
+				violations = append(violations, Violation{spec.Name, "is required"})
+			}
+			continue
+		}
+
+		if reason := spec.check(raw[0], v.Field(spec.field)); reason != "" {
+			violations = append(violations, Violation{spec.Name, reason})
+		}
+	}
+
+	if len(violations) != 0 {
+		return NewValidationError(v.Type().Name(), violations)
+	}
+
+	return nil
+}
+
+// parseRequest decodes the url parameters of r into req, see decodeParams.
+func parseRequest(r *http.Request, req interface{}) error {
+	r.ParseForm()
+	return decodeParams(r.Form, req)
+}
+
+// decodeMessage decodes the json object data into the request struct pointed to by req, and
+// checks it like decodeParams, reporting all violations at once. Unknown members and members
+// of the wrong type are violations, and a member is missing when absent or null, so that an
+// explicit 0 is kept apart from a missing parameter. The json names of the fields are their
+// param names.
+func decodeMessage(data []byte, req interface{}) error {
+	v := reflect.ValueOf(req).Elem()
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil || members == nil {
+		return NewValidationError(v.Type().Name(), []Violation{{"body", "must be a json object"}})
+	}
+
+	var violations []Violation
+	for _, spec := range paramSpecs(v.Type()) {
+		raw, ok := members[spec.Name]
+		delete(members, spec.Name)
+		if !ok || string(raw) == "null" {
+			if spec.Required {
+				violations = append(violations, Violation{spec.Name, "is required"})
+			}
+			continue
+		}
+
+		if reason := spec.decode(raw, v.Field(spec.field)); reason != "" {
+			violations = append(violations, Violation{spec.Name, reason})
+		}
+	}
+
+	unknown := make([]string, 0, len(members))
+	for name := range members {
+		unknown = append(unknown, name)
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		violations = append(violations, Violation{name, "is unknown"})
+	}
+
+	if len(violations) != 0 {
+		return NewValidationError(v.Type().Name(), violations)
+	}
+
+	return nil
+}
+
+// decode parses the json member raw into v, or returns why it is invalid.
+func (p ParamSpec) decode(raw json.RawMessage, v reflect.Value) string {
+	if err := json.Unmarshal(raw, v.Addr().Interface()); err != nil {
+		if p.Kind == reflect.String {
+			return "must be a string"
+		}
+		return "must be an integer"
+	}
+
+	return p.validate(v)
+}
+
+func NewValidationError(request string, violations []Violation) error {
+	reasons := make([]string, 0, len(violations))
+	for _, violation := range violations {
+		reasons = append(reasons, violation.Param+" "+violation.Reason)
+	}
+
+	err := NewError(ERROR_URL_PARAM_INVALID, "[decodeParams] invalid %v. %v", request, strings.Join(reasons, "; ")).(FollowerError)
+	err.Violations = violations
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"net/url"
+	"reflect"
+)
+
+var _ = Suite(&ValidationSuite{})
+
+type ValidationSuite struct{}
+
+func (p *ValidationSuite) SetUpTest(c *C) {
+	gobalConfig.UserIdLen = DefaultUserIdLen
+	gobalConfig.Versions = DefaultVersions
+}
+
+func (p *ValidationSuite) Test_paramSpecs_requestStructs(c *C) {
+	for _, req := range []interface{}{UserRequest{}, CoinsRequest{}, BuyFollowerRequest{}, UserRequestV2{}, CoinsRequestV2{}, BuyFollowerRequestV2{}} {
+		c.Assert(len(paramSpecs(reflect.TypeOf(req))) > 0, Equals, true)
+	}
+}
+
+func (p *ValidationSuite) Test_decodeParams(c *C) {
+	values := url.Values{"userId": {"000000001"}, "version": {"1"}, "coins": {"10"}, "value": {"2"}}
+
+	var req BuyFollowerRequest
+	c.Assert(decodeParams(values, &req), IsNil)
+	c.Assert(req, Equals, BuyFollowerRequest{UserId: "000000001", Version: 1, Coins: 10, Value: 2})
+}
+
+func (p *ValidationSuite) Test_decodeParams_allViolations(c *C) {
+	values := url.Values{"userId": {"1"}, "version": {"2"}, "coins": {"0"}}
+
+	var req BuyFollowerRequest
+	err := decodeParams(values, &req)
+	c.Assert(err, NotNil)
+
+	e := err.(FollowerError)
+	c.Assert(e.Code, Equals, ERROR_URL_PARAM_INVALID)
+	c.Assert(e.Violations, DeepEquals, []Violation{
+		{"userId", "must be 9 characters long"},
+		{"version", "unsupported version, supported versions are [1]"},
+		{"coins", "must be at least 1"},
+		{"value", "is required"},
+	})
+}
+
+func (p *ValidationSuite) Test_decodeParams_notInteger(c *C) {
+	var req CoinsRequest
+	err := decodeParams(url.Values{"userId": {"000000001"}, "version": {"1"}, "coins": {"ten"}}, &req)
+
+	c.Assert(err.(FollowerError).Violations, DeepEquals, []Violation{{"coins", "must be an integer"}})
+}
+
+func (p *ValidationSuite) Test_decodeMessage_zeroIsPresent(c *C) {
+	var req CoinsRequestV2
+	c.Assert(decodeMessage([]byte(`{"userId": "000000001", "coins": 0}`), &req), IsNil)
+	c.Assert(req, Equals, CoinsRequestV2{UserId: "000000001"})
+
+	err := decodeMessage([]byte(`{"userId": "000000001", "coins": null}`), &req)
+	c.Assert(err.(FollowerError).Violations, DeepEquals, []Violation{{"coins", "is required"}})
+
+	err = decodeMessage([]byte(`{"userId": "000000001"}`), &req)
+	c.Assert(err.(FollowerError).Violations, DeepEquals, []Violation{{"coins", "is required"}})
+}
+
+func (p *ValidationSuite) Test_decodeMessage_strict(c *C) {
+	for body, violation := range map[string]Violation{
+		`{"userId": "000000001", "coins": "10"}`:           {"coins", "must be an integer"},
+		`{"userId": 1, "coins": 10}`:                       {"userId", "must be a string"},
+		`{"userId": "000000001", "coins": 10, "bonus": 1}`: {"bonus", "is unknown"},
+		`[1]`:   {"body", "must be a json object"},
+		`null`:  {"body", "must be a json object"},
+		`{"use`: {"body", "must be a json object"},
+	} {
+		var req CoinsRequestV2
+		err := decodeMessage([]byte(body), &req)
+		c.Assert(err, NotNil, Commentf(body))
+		c.Assert(err.(FollowerError).Violations, DeepEquals, []Violation{violation}, Commentf(body))
+	}
+}
+
+func (p *ValidationSuite) Test_decodeMessage_rules(c *C) {
+	var req BuyFollowerRequestV2
+	err := decodeMessage([]byte(`{"userId": "1", "coins": 0, "value": 1}`), &req)
+
+	c.Assert(err.(FollowerError).Violations, DeepEquals, []Violation{
+		{"userId", "must be 9 characters long"},
+		{"coins", "must be at least 1"},
+	})
+}
+
+func (p *ValidationSuite) Test_decodeMessage_allViolations(c *C) {
+	var req BuyFollowerRequestV2
+	err := decodeMessage([]byte(`{"userId": 1, "coins": "10", "bonus": 1, "extra": true}`), &req)
+
+	c.Assert(err.(FollowerError).Violations, DeepEquals, []Violation{
+		{"userId", "must be a string"},
+		{"coins", "must be an integer"},
+		{"value", "is required"},
+		{"bonus", "is unknown"},
+		{"extra", "is unknown"},
+	})
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const VersionParam = "version"
+
+// VersionConfig is the lifecycle of one value of the version parameter of the v1 routes. A
+// version with Deprecation is answered with the Deprecation and Sunset headers, and one
+// which is Retired or past its Sunset is rejected with ERROR_VERSION_RETIRED.
+type VersionConfig struct {
+	Version     int64      `yaml:"version"`
+	Deprecation *time.Time `yaml:"deprecation"`
+	Sunset      *time.Time `yaml:"sunset"`
+	Retired     bool       `yaml:"retired"`
+}
+
+// VersionRegistry resolves the version parameter. Versions below min are rejected with
+// ERROR_UPGRADE_REQUIRED.
+type VersionRegistry struct {
+	versions map[int64]VersionConfig
+	min      int64
+}
+
+func NewVersionRegistry(versions []VersionConfig, min int64) *VersionRegistry {
+	registry := &VersionRegistry{versions: make(map[int64]VersionConfig), min: min}
+	for _, version := range versions {
+		registry.versions[version.Version] = version
+	}
+
+	return registry
+}
+
+// currentVersions returns the registry of the current config, which reloadConfig may change.
+func currentVersions() *VersionRegistry {
+	cfg := currentConfig()
+	return NewVersionRegistry(cfg.Versions, cfg.MinVersion)
+}
+
+func (p *VersionRegistry) Resolve(version int64, now time.Time) (VersionConfig, error) {
+	if version < p.min {
+		return VersionConfig{}, NewError(ERROR_UPGRADE_REQUIRED, "[VersionRegistry.Resolve] version below the minimum. version=%v minVersion=%v", version, p.min)
+	}
+
+	config, ok := p.versions[version]
+	if !ok {
+		return VersionConfig{}, NewError(ERROR_VERSION_UNSUPPORTED, "[VersionRegistry.Resolve] unknown version. version=%v supported=%v", version, p.Supported(now))
+	}
+	if config.retired(now) {
+		return VersionConfig{}, NewError(ERROR_VERSION_RETIRED, "[VersionRegistry.Resolve] retired version. version=%v", version)
+	}
+
+	return config, nil
+}
+
+// Supported returns the versions accepted at now, in ascending order.
+func (p *VersionRegistry) Supported(now time.Time) []int64 {
+	var supported []int64
+	for version, config := range p.versions {
+		if version >= p.min && !config.retired(now) {
+			supported = append(supported, version)
+		}
+	}
+	sort.Slice(supported, func(i, j int) bool { return supported[i] < supported[j] })
+
+	return supported
+}
+
+func (p VersionConfig) retired(now time.Time) bool {
+	return p.Retired || (p.Sunset != nil && !now.Before(*p.Sunset))
+}
+
+// setHeaders announces the deprecation of the version with the Deprecation header of
+// RFC 9745 and the Sunset header of RFC 8594.
+func (p VersionConfig) setHeaders(w http.ResponseWriter) {
+	if p.Deprecation != nil {
+		w.Header().Set("Deprecation", fmt.Sprintf("@%v", p.Deprecation.Unix()))
+	}
+	if p.Sunset != nil {
+		w.Header().Set("Sunset", p.Sunset.UTC().Format(http.TimeFormat))
+	}
+}
+
+// versioned resolves the version parameter of the route and serves it with the handler of
+// that version in route.Versions, or else route.Handler. A missing or malformed version is
+// left to the validation of the handler.
+func versioned(route Route) HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) error {
+		r.ParseForm()
+		version, err := strconv.ParseInt(r.Form.Get(VersionParam), 10, 64)
+		if err != nil {
+			return route.Handler(w, r)
+		}
+
+		config, err := currentVersions().Resolve(version, time.Now())
+		if err != nil {
+			return err
+		}
+		config.setHeaders(w)
+
+		if handler, ok := route.Versions[version]; ok {
+			return handler(w, r)
+		}
+		return route.Handler(w, r)
+	}
+}
+
+// hasVersionParam reports whether the request of the route has a parameter with the
+// version rule.
+func (p Route) hasVersionParam() bool {
+	if p.Request == nil {
+		return false
+	}
+
+	for _, spec := range paramSpecs(reflect.TypeOf(p.Request)) {
+		if spec.Version {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateVersions(versions []VersionConfig, min int64) []string {
+	var problems []string
+	seen := make(map[int64]bool)
+	for i, version := range versions {
+		if version.Version <= 0 {
+			problems = append(problems, fmt.Sprintf("versions[%v].version must be positive, got %v", i, version.Version))
+		}
+		if seen[version.Version] {
+			problems = append(problems, fmt.Sprintf("versions[%v].version %v is listed twice", i, version.Version))
+		}
+		seen[version.Version] = true
+
+		if version.Deprecation != nil && version.Sunset != nil && version.Sunset.Before(*version.Deprecation) {
+			problems = append(problems, fmt.Sprintf("versions[%v].sunset is before its deprecation", i))
+		}
+	}
+	if min < 0 {
+		problems = append(problems, fmt.Sprintf("min_version must not be negative, got %v", min))
+	}
+
+	return problems
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"net/http"
+	"net/http/httptest"
+	"time"
+)
+
+var _ = Suite(&VersionSuite{})
+
+type VersionSuite struct{}
+
+func (p *VersionSuite) TearDownTest(c *C) {
+	gobalConfig.Versions = nil
+	gobalConfig.MinVersion = 0
+}
+
+func (p *VersionSuite) Test_Resolve(c *C) {
+	now := time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+	deprecation, sunset := now.AddDate(0, -1, 0), now.AddDate(0, 1, 0)
+	registry := NewVersionRegistry([]VersionConfig{
+		{Version: 1, Retired: true},
+		{Version: 2},
+		{Version: 3, Deprecation: &deprecation, Sunset: &sunset},
+		{Version: 4},
+	}, 2)
+
+	_, err := registry.Resolve(1, now)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_UPGRADE_REQUIRED)
+	_, err = registry.Resolve(5, now)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_VERSION_UNSUPPORTED)
+
+	version, err := registry.Resolve(3, now)
+	c.Assert(err, IsNil)
+	c.Assert(version.Sunset, Equals, &sunset)
+	c.Assert(registry.Supported(now), DeepEquals, []int64{2, 3, 4})
+
+	_, err = registry.Resolve(3, sunset)
+	c.Assert(err.(FollowerError).Code, Equals, ERROR_VERSION_RETIRED)
+	c.Assert(registry.Supported(sunset), DeepEquals, []int64{2, 4})
+}
+
+func (p *VersionSuite) Test_versioned(c *C) {
+	deprecation := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Now().AddDate(1, 0, 0)
+	gobalConfig.Versions = []VersionConfig{{Version: 1, Deprecation: &deprecation, Sunset: &sunset}, {Version: 2}, {Version: 3, Retired: true}}
+
+	handlerOf := func(version string) HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) error {
+			w.Header().Set("X-Handler", version)
+			return nil
+		}
+	}
+	handler := handle(versioned(Route{Path: "/test", Handler: handlerOf("default"), Versions: map[int64]HandlerFunc{2: handlerOf("2")}}))
+
+	serve := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", url, nil))
+		return w
+	}
+
+	w := serve("/test?version=1")
+	c.Assert(w.Header().Get("X-Handler"), Equals, "default")
+	c.Assert(w.Header().Get("Deprecation"), Equals, "@1767225600")
+	c.Assert(w.Header().Get("Sunset"), Equals, sunset.UTC().Format(http.TimeFormat))
+
+	w = serve("/test?version=2")
+	c.Assert(w.Header().Get("X-Handler"), Equals, "2")
+	c.Assert(w.Header().Get("Deprecation"), Equals, "")
+
+	c.Assert(serve("/test?version=3").Code, Equals, http.StatusGone)
+	c.Assert(serve("/test?version=4").Code, Equals, http.StatusBadRequest)
+
+	gobalConfig.MinVersion = 2
+	c.Assert(serve("/test?version=1").Code, Equals, http.StatusUpgradeRequired)
+
+	// left to the validation of the handler
+	c.Assert(serve("/test").Header().Get("X-Handler"), Equals, "default")
+}
+
+func (p *VersionSuite) Test_hasVersionParam(c *C) {
+	c.Assert(Route{Request: UserRequest{}}.hasVersionParam(), Equals, true)
+	c.Assert(Route{Request: UserRequestV2{}}.hasVersionParam(), Equals, false)
+	c.Assert(Route{}.hasVersionParam(), Equals, false)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -10,99 +11,265 @@ import (
 	"io"
 	"net/http"
 	"os"
-	"path/filepath"
 	"time"
 )
 
 var gobalMgoSession *mgo.Session
 
+var gobalHttpServer *http.Server
+
 func main() {
 	parseCommandLine()
+	signals := notifySignals()
 
 	initLog()
+	initAccessLog()
+	initTracing()
+	initApps()
+	initTrustedProxies()
 	initMongo()
-	loadUserOrders()
+	initDbBreaker()
+	initUserCache()
+	initIdempotency()
 	startCounter()
+	startRateLimiterCleaner()
+	initConcurrencyLimiter()
 
 	startHttp()
+	startGrpc()
+	startAdmin()
+	loadUserOrders()
+	waitForShutdown(signals)
 }
 
 func parseCommandLine() {
-	requiredArgs := 2
-
 	flag.Usage = func() {
 		fmt.Printf("Usage: %s [OPTIONS] \noptions:\n", os.Args[0])
 		flag.PrintDefaults()
+		fmt.Printf("\nevery option can also be set in the config file, or by the environment variable %vOPTION_NAME.\n", EnvPrefix)
 	}
 
-	flag.StringVar(&gobalConfig.IP, "bind_ip", "", "http server ip. (Required)")
-	flag.IntVar(&gobalConfig.Port, "port", DefaultPort, "http server port.")
-	flag.StringVar(&gobalConfig.MongoUri, "mongoUri", "", "mongodb uri. (Required)")
+	defineFlags(flag.CommandLine)
 	flag.Parse()
 
-	if flag.NFlag() != requiredArgs {
+	cfg, err := loadConfig(flag.CommandLine, gobalConfigFile)
+	if err != nil {
+		fmt.Println(err)
 		flag.Usage()
+		os.Exit(1)
 	}
+
+	gobalConfig = cfg
+}
+
+// defineFlags defines a flag for every scalar config key. The flags only provide the
+// defaults and command line values to loadConfig.
+func defineFlags(flags *flag.FlagSet) {
+	var cmdline Config
+	flags.StringVar(&gobalConfigFile, "config", os.Getenv(EnvPrefix+"CONFIG"), "yaml config file.")
+	flags.StringVar(&cmdline.IP, "bind_ip", "", "http server ip.")
+	flags.IntVar(&cmdline.Port, "port", DefaultPort, "http server port.")
+	flags.StringVar(&cmdline.MongoUri, "mongo_uri", "", "mongodb uri. (Required)")
+	flags.StringVar(&cmdline.MongoUri, "mongoUri", "", "deprecated alias of mongo_uri.")
+	flags.StringVar(&cmdline.DbName, "db_name", DefaultDbName, "mongodb database.")
+	flags.StringVar(&cmdline.CollName, "coll_name", DefaultCollName, "mongodb collection of users.")
+	flags.Int64Var(&cmdline.CoinsPerFollower, "coins_per_follower", 0, "minimum coins per follower in buyfollower. 0 accepts any price.")
+	flags.IntVar(&cmdline.PushBatchSize, "push_batch_size", DefaultPushBatchSize, "number of buyers returned by getuser.")
+	flags.IntVar(&cmdline.UserIdLen, "userid_len", DefaultUserIdLen, "length of a valid userId.")
+	flags.BoolVar(&cmdline.TLS, "tls", true, "serve https. false serves plain http, e.g. behind a tls terminating proxy.")
+	flags.StringVar(&cmdline.CertFile, "cert_file", DefaultCertFile, "tls certificate file.")
+	flags.StringVar(&cmdline.KeyFile, "key_file", DefaultKeyFile, "tls private key file.")
+	flags.DurationVar(&cmdline.CertReloadInterval, "cert_reload_interval", DefaultCertReloadInterval, "check the certificate files for changes at this interval. 0 disables.")
+	flags.StringVar(&cmdline.TLSMinVersion, "tls_min_version", DefaultTLSMinVersion, "minimum tls version: 1.0, 1.1, 1.2 or 1.3.")
+	flags.StringVar(&cmdline.ClientCAFile, "client_ca_file", "", "ca certificates of the clients allowed on the admin listener. empty serves it as plain http.")
+	flags.StringVar(&cmdline.AdminAddr, "admin_addr", DefaultAdminAddr, "admin listener, host:port or unix:/path/to/socket.")
+	flags.StringVar(&cmdline.LogPath, "log_path", DefaultLogPath, "log folder.")
+	flags.StringVar(&cmdline.LogLevel, "log_level", DefaultLogLevel, "log level: debug, info, warn, error.")
+	flags.StringVar(&cmdline.LogFormat, "log_format", DefaultLogFormat, "log format: text or json.")
+	flags.IntVar(&cmdline.LogMaxSize, "log_max_size", DefaultLogMaxSize, "rotate the log file when it exceeds this size in megabytes.")
+	flags.IntVar(&cmdline.LogMaxAge, "log_max_age", DefaultLogMaxAge, "days to retain rotated log files. 0 keeps them forever.")
+	flags.IntVar(&cmdline.LogMaxBackups, "log_max_backups", DefaultLogMaxBackups, "number of rotated log files to retain. 0 keeps all.")
+	flags.DurationVar(&cmdline.LogRotateInterval, "log_rotate_interval", 0, "also rotate the log file at this interval, e.g. 24h. 0 disables.")
+	flags.StringVar(&cmdline.AccessLog, "access_log", DefaultAccessLog, "access log file, relative to log_path. empty disables the access log.")
+	flags.StringVar(&cmdline.AccessLogFormat, "access_log_format", DefaultAccessLogFormat, "access log format: combined or json.")
+	flags.BoolVar(&cmdline.AccessLogHashUserId, "access_log_hash_userid", false, "write a hash of userId instead of userId to the access log.")
+	flags.StringVar(&cmdline.TraceExporter, "trace_exporter", DefaultTraceExporter, "trace exporter: none, stdout or otlp.")
+	flags.StringVar(&cmdline.TraceEndpoint, "trace_endpoint", DefaultTraceEndpoint, "otlp http endpoint, host:port.")
+	flags.BoolVar(&cmdline.TraceInsecure, "trace_insecure", false, "connect to the otlp endpoint without tls.")
+	flags.Float64Var(&cmdline.TraceSampleRatio, "trace_sample_ratio", DefaultTraceSampleRatio, "fraction of new traces to sample, 0 to 1.")
+	flags.DurationVar(&cmdline.ShutdownDelay, "shutdown_delay", DefaultShutdownDelay, "time to keep serving with /readyz failing before shutting down.")
+	flags.DurationVar(&cmdline.ShutdownTimeout, "shutdown_timeout", DefaultShutdownTimeout, "time to wait for in-flight requests on shutdown.")
+	flags.DurationVar(&cmdline.ReadHeaderTimeout, "read_header_timeout", DefaultReadHeaderTimeout, "time to read the request headers. 0 disables.")
+	flags.DurationVar(&cmdline.ReadTimeout, "read_timeout", DefaultReadTimeout, "time to read the whole request. 0 disables.")
+	flags.DurationVar(&cmdline.WriteTimeout, "write_timeout", DefaultWriteTimeout, "time to write the response. 0 disables.")
+	flags.DurationVar(&cmdline.IdleTimeout, "idle_timeout", DefaultIdleTimeout, "time to keep an idle keep-alive connection. 0 disables.")
+	flags.IntVar(&cmdline.UserCacheSize, "user_cache_size", DefaultUserCacheSize, "cached info and progress results served while mongodb is unavailable. 0 disables.")
+	flags.DurationVar(&cmdline.RequestTimeout, "request_timeout", DefaultRequestTimeout, "deadline of every client request, answered with 504 when exceeded.")
+	flags.DurationVar(&cmdline.IdempotencyTTL, "idempotency_ttl", DefaultIdempotencyTTL, "time the responses of write requests are kept by Idempotency-Key. 0 disables.")
+	flags.IntVar(&cmdline.IdempotencyMaxKeys, "idempotency_max_keys", DefaultIdempotencyMaxKeys, "Idempotency-Key responses kept at most, dropping the least recently used.")
+	flags.StringVar(&cmdline.GrpcAddr, "grpc_addr", "", "grpc server address, e.g. :9090. empty disables.")
+	flags.IntVar(&cmdline.GrpcMaxWatches, "grpc_max_watches", DefaultGrpcMaxWatches, "WatchProgress streams running at most. 0 is no limit.")
+	flags.BoolVar(&cmdline.ValidateResponses, "validate_responses", false, "log the client responses which differ from the openapi document. for debugging.")
 }
 
 func startHttp() {
-	http.HandleFunc("/counter", counterHander)
+	initTLS()
 
-	http.HandleFunc("/getfollowers/coins", Decorate(coinsHandler, loggingAndRespError(), counting(&gobalCounter)))
-	http.HandleFunc("/getfollowers/info", Decorate(infoHandler, loggingAndRespError(), counting(&gobalCounter)))
-	http.HandleFunc("/getfollowers/buyfollower", Decorate(buyfollowerHandler, loggingAndRespError(), counting(&gobalCounter)))
-	http.HandleFunc("/getfollowers/getuser", Decorate(getUserHandler, loggingAndRespError(), counting(&gobalCounter)))
-	http.HandleFunc("/getfollowers/progress", Decorate(progressHandler, loggingAndRespError(), counting(&gobalCounter)))
+	if gobalConfig.ValidateResponses {
+		gobalOpenApi = NewOpenApi(clientRoutes)
+	}
 
-	log.Infof("start http server. ip:%v port=%v", gobalConfig.IP, gobalConfig.Port)
+	mux := http.NewServeMux()
+	v2 := NewRouter()
+	for _, route := range clientRoutes {
+		fn := route.Handler
+		if route.hasVersionParam() {
+			fn = versioned(route)
+		}
 
-	addr := fmt.Sprintf("%v:%v", gobalConfig.IP, gobalConfig.Port)
-	err := http.ListenAndServeTLS(addr, "server.crt", "server.key", nil)
-	if err != nil {
-		log.Errorf(fmt.Sprintf("[startHttp] http.ListenAndServe failed. error=%v", err))
-		os.Exit(1)
+		handler := Decorate(handle(fn), clientDecorators(route)...)
+		if route.Method == "" {
+			mux.HandleFunc(route.Path, handler)
+		} else {
+			v2.Handle(route.Method, route.Path, handler)
+		}
+	}
+	mux.Handle("/v2/", v2)
+
+	log.Infof("start http server. ip:%v port=%v tls=%v", gobalConfig.IP, gobalConfig.Port, gobalConfig.TLS)
+
+	gobalHttpServer = &http.Server{
+		Addr:              fmt.Sprintf("%v:%v", gobalConfig.IP, gobalConfig.Port),
+		Handler:           mux,
+		ReadHeaderTimeout: gobalConfig.ReadHeaderTimeout,
+		ReadTimeout:       gobalConfig.ReadTimeout,
+		WriteTimeout:      gobalConfig.WriteTimeout,
+		IdleTimeout:       gobalConfig.IdleTimeout,
 	}
+
+	go func() {
+		var err error
+		if gobalConfig.TLS {
+			gobalHttpServer.TLSConfig = newTLSConfig(false)
+			err = gobalHttpServer.ListenAndServeTLS("", "")
+		} else {
+			err = gobalHttpServer.ListenAndServe()
+		}
+
+		if err != nil && err != http.ErrServerClosed {
+			log.Errorf("[startHttp] http server failed. tls=%v error=%v", gobalConfig.TLS, err)
+			os.Exit(1)
+		}
+	}()
 }
 
-func initMongo() {
-	session, err := mgo.Dial(gobalConfig.MongoUri)
-	if err != nil {
-		log.Errorf("[initMongo] connect to mongodb failed. mongoUri=%v", gobalConfig.MongoUri)
-		os.Exit(1)
+// clientRoutes are the client api. The v1 routes under /getfollowers accept any method and
+// read the url parameters, the v2 routes under /v2 check the method and read the json body
+// of POST, see jsonBody.
+var clientRoutes = []Route{
+	{Path: "/getfollowers/coins", Handler: coinsHandler, Request: CoinsRequest{}, Response: CoinsResponse{}, Write: true},
+	{Path: "/getfollowers/info", Handler: infoHandler, Request: UserRequest{}, Response: InfoResponse{}},
+	{Path: "/getfollowers/buyfollower", Handler: buyfollowerHandler, Request: BuyFollowerRequest{}, Response: BuyFollowerResponse{}, Write: true},
+	{Path: "/getfollowers/getuser", Handler: getUserHandler, Request: UserRequest{}, Response: GetUserResponse{}, Write: true},
+	{Path: "/getfollowers/progress", Handler: progressHandler, Request: UserRequest{}, Response: ProgressResponse{}},
+	{Path: "/getfollowers/errors", Handler: errorCatalogHandler, Response: ErrorCatalogResponse{}, Static: true},
+
+	{Method: http.MethodPost, Path: "/v2/coins", Handler: coinsHandlerV2, Request: CoinsRequestV2{}, Response: CoinsResponse{}, Write: true},
+	{Method: http.MethodGet, Path: "/v2/info", Handler: infoHandlerV2, Request: UserRequestV2{}, Response: InfoResponse{}},
+	{Method: http.MethodPost, Path: "/v2/buyfollower", Handler: buyfollowerHandlerV2, Request: BuyFollowerRequestV2{}, Response: BuyFollowerResponse{}, Write: true},
+	{Method: http.MethodPost, Path: "/v2/getuser", Handler: getUserHandlerV2, Request: UserRequestV2{}, Response: GetUserResponse{}, Write: true},
+	{Method: http.MethodGet, Path: "/v2/progress", Handler: progressHandlerV2, Request: UserRequestV2{}, Response: ProgressResponse{}},
+	{Method: http.MethodGet, Path: "/v2/errors", Handler: errorCatalogHandler, Response: ErrorCatalogResponse{}, Static: true},
+}
+
+// isClientRoute reports whether path is the path of a client route.
+func isClientRoute(path string) bool {
+	for _, route := range clientRoutes {
+		if route.Path == path {
+			return true
+		}
 	}
 
-	gobalMgoSession = session
+	return false
 }
 
-func initLog() {
-	logPath := "log"
-	if _, err := os.Stat(logPath); err != nil {
-		err = os.Mkdir(logPath, os.ModeDir)
-		if err != nil {
-			fmt.Println("create log forlder failed. error=%v", err)
-			os.Exit(1)
+// isClientOperation reports whether name is the operation of a client route.
+func isClientOperation(name string) bool {
+	for _, route := range clientRoutes {
+		if route.Operation() == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isWriteOperation reports whether the routes of operation write, see Route.Write.
+func isWriteOperation(operation string) bool {
+	for _, route := range clientRoutes {
+		if route.Operation() == operation && route.Write {
+			return true
 		}
 	}
 
-	now := time.Now()
-	logSuffix := fmt.Sprintf("-%d-%02d-%02dT%02d%02d%02d.log", now.Year(), now.Month(), now.Day(), now.Hour(), now.Minute(), now.Second())
-	logName := filepath.Base(os.Args[0])
-	logName = logPath + "//" + logName + logSuffix
+	return false
+}
+
+// clientDecorators returns the decorators shared by all client api, innermost first. A
+// Static route only gets a request id and the access log.
+func clientDecorators(route Route) []Decorator {
+	if route.Static {
+		return []Decorator{requestId(), accessLogging(gobalAccessLogger)}
+	}
+
+	decorators := []Decorator{
+		idempotent(gobalIdempotencyStore, route),
+		withApp(),
+		concurrencyLimiting(gobalConcurrencyLimiter),
+		rateLimiting(gobalRateLimiter, route.Operation()),
+		withTimeout(gobalConfig.RequestTimeout),
+	}
+
+	// before rateLimiting and idempotent, so that they see the userId of the body, and inside
+	// underMaintenance, so that a body is not read in maintenance.
+	if route.Method == http.MethodPost {
+		decorators = append(decorators, jsonBody(route))
+	}
 
-	f, err := os.OpenFile(logName, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0666)
+	return append(decorators,
+		underMaintenance(&gobalMaintenance, route.Operation()),
+		recovering(),
+		counting(&gobalCounter),
+		conformance(gobalOpenApi, route),
+		requestId(),
+		tracing(),
+		accessLogging(gobalAccessLogger),
+	)
+}
+
+func initMongo() {
+	session, err := mgo.Dial(gobalConfig.MongoUri)
 	if err != nil {
-		fmt.Printf("error opening file: %v", err)
+		log.Errorf("[initMongo] connect to mongodb failed. mongoUri=%v", gobalConfig.MongoUri)
 		os.Exit(1)
 	}
 
-	log.SetFormatter(&log.TextFormatter{})
-	log.SetOutput(f)
-	log.SetLevel(log.InfoLevel)
+	gobalMgoSession = session
 }
 
 func loadUserOrders() {
-	collection := gobalMgoSession.DB("follower").C("user")
+	for _, app := range gobalApps.All() {
+		loadAppOrders(app)
+	}
+}
+
+func loadAppOrders(app *App) {
+	session := gobalMgoSession.Copy()
+	defer session.Close()
+
+	collection := app.Collection(session)
 	queryStatement := bson.M{"orders": bson.M{"$elemMatch": bson.M{"status": false}}}
+	_, span := startDbSpan(context.Background(), "find", collection)
 	iter := collection.Find(queryStatement).Select(bson.M{"_id": 0, "userId": 1, "orders": bson.M{"$elemMatch": bson.M{"status": false}}}).Iter()
 
 	var result bson.M
@@ -111,27 +278,35 @@ func loadUserOrders() {
 		if orders, ok := result["orders"]; ok {
 			for _, order := range orders.([]interface{}) {
 
-				item := PushItem{&Order{
-					order.(bson.M)["orderId"].(string),
-					order.(bson.M)["coins"].(int64),
-					order.(bson.M)["date"].(int64),
-					order.(bson.M)["fans"].(int64),
-					order.(bson.M)["progress"].(int64),
-					order.(bson.M)["status"].(bool),
-				}, result["userId"].(string)}
+				item := PushItem{orderFromBson(order.(bson.M)), result["userId"].(string)}
 
-				gobalPushManger.Add(&item)
+				app.PushManager.Add(context.Background(), &item)
 				counter++
 			}
 		}
 	}
 
-	if err := iter.Close(); err != nil {
-		log.Errorf("load user orders failed. err=%v", err)
+	err := iter.Close()
+	endSpan(span, err)
+	if err != nil {
+		log.Errorf("load user orders failed. app=%v err=%v", app.Name, err)
 		os.Exit(1)
 	}
 
-	log.Infof("load user orders success. count:%d", counter)
+	app.PushManager.SetLoaded()
+	log.Infof("load user orders success. app=%v count:%d", app.Name, counter)
+}
+
+// orderFromBson reads an order of the orders array of a user document.
+func orderFromBson(order bson.M) *Order {
+	return &Order{
+		OrderId:  order["orderId"].(string),
+		Date:     order["date"].(int64),
+		Coins:    order["coins"].(int64),
+		Fans:     order["fans"].(int64),
+		Progress: order["progress"].(int64),
+		Status:   order["status"].(bool),
+	}
 }
 
 func startCounter() {
@@ -152,13 +327,13 @@ func responseError(w http.ResponseWriter, err error) {
 	err = err.(FollowerError)
 	respByte, err := json.Marshal(err)
 	if err != nil {
-		log.Error("[responseError] json.Marshaler failed. error=%v", err.Error())
+		log.Errorf("[responseError] json.Marshaler failed. error=%v", err.Error())
 		return
 	}
 
 	_, err = io.WriteString(w, string(respByte))
 	if err != nil {
-		log.Error("[responseError] io.WriteString failed. error=%v", err.Error())
+		log.Errorf("[responseError] io.WriteString failed. error=%v", err.Error())
 		return
 
 	}
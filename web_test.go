@@ -0,0 +1,56 @@
+package main
+
+import (
+	. "gopkg.in/check.v1"
+	"gopkg.in/mgo.v2/bson"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+var _ = Suite(&WebSuite{})
+
+type WebSuite struct{}
+
+func (p *WebSuite) Test_orderFromBson(c *C) {
+	order := orderFromBson(bson.M{"orderId": "o1", "date": int64(1500000000), "coins": int64(30), "fans": int64(3), "progress": int64(1), "status": false})
+
+	c.Assert(*order, Equals, Order{OrderId: "o1", Date: 1500000000, Coins: 30, Fans: 3, Progress: 1})
+}
+
+// Test_clientDecorators_maintenance checks that a json body is not read in maintenance.
+func (p *WebSuite) Test_clientDecorators_maintenance(c *C) {
+	gobalMaintenance.Set(MaintenanceState{Enabled: true})
+	defer gobalMaintenance.Set(MaintenanceState{})
+
+	for _, route := range clientRoutes {
+		if route.Path != "/v2/buyfollower" {
+			continue
+		}
+
+		handler := Decorate(handle(route.Handler), clientDecorators(route)...)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("POST", route.Path, strings.NewReader("userId=000000001")))
+
+		c.Assert(w.Code, Equals, http.StatusServiceUnavailable)
+		c.Assert(w.Header().Get(RequestIdHeader), Not(Equals), "")
+	}
+}
+
+func (p *WebSuite) Test_clientDecorators_static(c *C) {
+	gobalMaintenance.Set(MaintenanceState{Enabled: true})
+	defer gobalMaintenance.Set(MaintenanceState{})
+
+	for _, route := range clientRoutes {
+		if !route.Static {
+			continue
+		}
+
+		handler := Decorate(handle(route.Handler), clientDecorators(route)...)
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", route.Path, nil))
+
+		c.Assert(w.Code, Equals, http.StatusOK, Commentf(route.Path))
+		c.Assert(w.Header().Get(RequestIdHeader), Not(Equals), "")
+	}
+}